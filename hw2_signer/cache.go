@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignerCache, if set, is consulted before every DataSignerCrc32/DataSignerMd5
+// call made by SingleHash and MultiHash. nil means no caching.
+var SignerCache *SignCache
+
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Shared counts lookups that waited for an identical call already in flight
+	Shared uint64
+	// StoreErrors counts failed writes to the on-disk store
+	StoreErrors uint64
+}
+
+type cacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+type signCall struct {
+	wg  sync.WaitGroup
+	val string
+	err error
+}
+
+// SignCache is an in-memory LRU with optional TTL in front of the signer
+// functions. Identical concurrent lookups are merged into one signer call.
+type SignCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+	calls map[string]*signCall
+	store *SignStore
+	stats CacheStats
+}
+
+// NewSignCache keeps at most size results, each for ttl. ttl == 0 means results never expire.
+func NewSignCache(size int, ttl time.Duration) *SignCache {
+	return &SignCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+		calls: make(map[string]*signCall),
+	}
+}
+
+// WithStore puts an on-disk store behind the LRU: misses are looked up there
+// before calling the signer, and new results are written to it.
+func (c *SignCache) WithStore(s *SignStore) *SignCache {
+	c.store = s
+	return c
+}
+
+func (c *SignCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Get returns sign(data), reusing a previous result for the same kind, data and DataSignerSalt.
+// Errors are passed to every waiting caller but are not cached.
+func (c *SignCache) Get(kind, data string, sign SignFunc) (string, error) {
+	key := kind + "|" + DataSignerSalt + "|" + data
+
+	c.mu.Lock()
+	if v, ok := c.lookup(key); ok {
+		c.stats.Hits++
+		c.mu.Unlock()
+		return v, nil
+	}
+	if call, ok := c.calls[key]; ok {
+		c.stats.Shared++
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+	if c.store != nil {
+		if v, ok := c.store.Get(key); ok {
+			c.stats.Hits++
+			c.add(key, v)
+			c.mu.Unlock()
+			return v, nil
+		}
+	}
+	c.stats.Misses++
+	call := &signCall{}
+	call.wg.Add(1)
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	c.do(key, call, data, sign)
+	return call.val, call.err
+}
+
+// do runs the call and publishes its result. If sign panics, the call is still
+// finished with an error for the waiting lookups, and the panic goes on to the caller.
+func (c *SignCache) do(key string, call *signCall, data string, sign SignFunc) {
+	finished := false
+	defer func() {
+		if finished {
+			return
+		}
+		p := recover()
+		call.err = fmt.Errorf("signer panicked: %v", p)
+		c.finish(key, call, nil)
+		panic(p)
+	}()
+	call.val, call.err = sign(data)
+	finished = true
+
+	var storeErr error
+	if c.store != nil && call.err == nil {
+		storeErr = c.store.Put(key, call.val)
+	}
+	c.finish(key, call, storeErr)
+}
+
+func (c *SignCache) finish(key string, call *signCall, storeErr error) {
+	c.mu.Lock()
+	if call.err == nil {
+		c.add(key, call.val)
+	}
+	delete(c.calls, key)
+	if storeErr != nil {
+		c.stats.StoreErrors++
+	}
+	c.mu.Unlock()
+	call.wg.Done()
+}
+
+func (c *SignCache) lookup(key string) (string, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *SignCache) add(key, value string) {
+	if c.size <= 0 {
+		return
+	}
+	entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*cacheEntry).key)
+	}
+}
+
+// SignStore is an append-only file of signer results, one quoted key/value pair per line.
+// The whole file is loaded into memory on open.
+type SignStore struct {
+	mu   sync.Mutex
+	file *os.File
+	data map[string]string
+}
+
+// OpenSignStore opens or creates the store at path. A torn line at the end,
+// left by a crash in the middle of Put, is cut off.
+func OpenSignStore(path string) (*SignStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &SignStore{file: file, data: make(map[string]string)}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *SignStore) load() error {
+	r := bufio.NewReader(s.file)
+	var good int64
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		key, value, err := parseStoreLine(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		s.data[key] = value
+		good += int64(len(line))
+	}
+	return s.file.Truncate(good)
+}
+
+func parseStoreLine(line string) (string, string, error) {
+	quotedKey, err := strconv.QuotedPrefix(line)
+	if err != nil {
+		return "", "", err
+	}
+	key, _ := strconv.Unquote(quotedKey)
+	value, err := strconv.Unquote(strings.TrimPrefix(line[len(quotedKey):], " "))
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+func (s *SignStore) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *SignStore) Put(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.data[key]; ok && old == value {
+		return nil
+	}
+	s.data[key] = value
+	_, err := fmt.Fprintf(s.file, "%s %s\n", strconv.Quote(key), strconv.Quote(value))
+	return err
+}
+
+func (s *SignStore) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignCache(t *testing.T) {
+	var calls uint32
+	sign := func(data string) (string, error) {
+		atomic.AddUint32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "h" + data, nil
+	}
+
+	cache := NewSignCache(2, 0)
+
+	// одинаковые одновременные запросы должны схлопнуться в один вызов
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, _ := cache.Get("crc32", "1", sign); res != "h1" {
+				t.Errorf("wrong result\nGot: %v\nExpected: %v", res, "h1")
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("concurrent calls not merged\nGot: %d calls\nExpected: 1", calls)
+	}
+
+	cache.Get("crc32", "2", sign)
+	cache.Get("crc32", "3", sign) // вытесняет "1"
+	cache.Get("crc32", "1", sign)
+	if calls != 4 {
+		t.Errorf("lru eviction not working\nGot: %d calls\nExpected: 4", calls)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits+stats.Shared != 9 || stats.Misses != 4 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	ttlCache := NewSignCache(10, time.Millisecond)
+	ttlCache.Get("md5", "1", sign)
+	time.Sleep(5 * time.Millisecond)
+	ttlCache.Get("md5", "1", sign)
+	if calls != 6 {
+		t.Errorf("expired entry was reused\nGot: %d calls\nExpected: 6", calls)
+	}
+}
+
+func TestSignStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signs.db")
+
+	store, err := OpenSignStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.Put("crc32|salt \"q\"|"+strconv.Itoa(i), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	store, err = OpenSignStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cache := NewSignCache(10, 0).WithStore(store)
+	DataSignerSalt = "salt \"q\""
+	defer func() { DataSignerSalt = "" }()
+
+	res, err := cache.Get("crc32", "2", func(string) (string, error) {
+		t.Error("signer called for stored value")
+		return "", nil
+	})
+	if err != nil || res != "v2" {
+		t.Errorf("wrong stored result\nGot: %v\nExpected: %v", res, "v2")
+	}
+}
+
+func TestSignStoreTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signs.db")
+	// последняя строка оборвана посреди Put
+	if err := os.WriteFile(path, []byte("\"a\" \"1\"\n\"b\" \"2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenSignStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get("b"); ok {
+		t.Errorf("torn line loaded")
+	}
+	if err := store.Put("c", "3"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	data, _ := os.ReadFile(path)
+	expected := "\"a\" \"1\"\n\"c\" \"3\"\n"
+	if string(data) != expected {
+		t.Errorf("torn line not cut off\nGot: %q\nExpected: %q", data, expected)
+	}
+
+	// испорченная строка не в конце - ошибка
+	os.WriteFile(path, []byte("\"a\" 1\n\"c\" \"3\"\n"), 0644)
+	if _, err := OpenSignStore(path); err == nil {
+		t.Errorf("expected error for corrupt line")
+	}
+}
+
+func TestSignCachePanic(t *testing.T) {
+	cache := NewSignCache(10, 0)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("panic not passed on")
+			}
+		}()
+		cache.Get("md5", "1", func(string) (string, error) { panic("boom") })
+	}()
+
+	// следующий такой же запрос не должен ждать вечно
+	done := make(chan string)
+	go func() {
+		res, _ := cache.Get("md5", "1", func(string) (string, error) { return "ok", nil })
+		done <- res
+	}()
+	select {
+	case res := <-done:
+		if res != "ok" {
+			t.Errorf("wrong result\nGot: %v\nExpected: %v", res, "ok")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup after a panic blocked")
+	}
+}
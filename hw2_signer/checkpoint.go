@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type checkpointRecord struct {
+	Stage string `json:"stage"`
+	Salt  string `json:"salt,omitempty"`
+	ID    string `json:"id"`
+	// Int or Str holds the output, depending on its type
+	Int *int    `json:"int,omitempty"`
+	Str *string `json:"str,omitempty"`
+}
+
+// Checkpoint is an append-only log of items already processed by pipeline stages,
+// one JSON record per line. Every record is written with its own write call, so
+// it survives a crash of the process; Close syncs the file to disk.
+type Checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]interface{}
+}
+
+// OpenCheckpoint opens or creates the log at path. A torn record at the end,
+// left by a crash in the middle of a write, is cut off.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{file: file, done: make(map[string]interface{})}
+	if err := cp.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cp, nil
+}
+
+func (cp *Checkpoint) load() error {
+	r := bufio.NewReader(cp.file)
+	var good int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rec := checkpointRecord{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return fmt.Errorf("offset %d: %v", good, err)
+		}
+		switch {
+		case rec.Int != nil:
+			cp.done[checkpointKey(rec.Stage, rec.Salt, rec.ID)] = *rec.Int
+		case rec.Str != nil:
+			cp.done[checkpointKey(rec.Stage, rec.Salt, rec.ID)] = *rec.Str
+		}
+		good += int64(len(line))
+	}
+	if err := cp.file.Truncate(good); err != nil {
+		return err
+	}
+	_, err := cp.file.Seek(good, io.SeekStart)
+	return err
+}
+
+func checkpointKey(stage, salt, id string) string {
+	return stage + "\x00" + salt + "\x00" + id
+}
+
+func itemID(item interface{}) string {
+	return fmt.Sprintf("%[1]T:%[1]v", item)
+}
+
+// Len returns the number of recorded items.
+func (cp *Checkpoint) Len() int {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return len(cp.done)
+}
+
+// Item wraps fn of the named stage: items recorded earlier are not processed again,
+// their recorded output is returned instead. Items are identified by type and value
+// and by DataSignerSalt. The stage name has to change along with anything else
+// fn depends on, like its Scheme. The priority of Prioritized items doesn't change
+// their results, it is kept on the result but not recorded.
+func (cp *Checkpoint) Item(stage string, fn ItemFunc) ItemFunc {
+	return func(item interface{}) (interface{}, error) {
+		return withPriority(item, func(item interface{}, priority int) (interface{}, error) {
+			return cp.item(stage, fn, item, priority)
+		})
+	}
+}
+
+func (cp *Checkpoint) item(stage string, fn ItemFunc, item interface{}, priority int) (interface{}, error) {
+	salt := DataSignerSalt
+	key := checkpointKey(stage, salt, itemID(item))
+	cp.mu.Lock()
+	res, ok := cp.done[key]
+	cp.mu.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	// fn still gets the priority, it may schedule by it
+	arg := item
+	if priority != 0 {
+		arg = Prioritized{Item: item, Priority: priority}
+	}
+	res, err := fn(arg)
+	if err != nil {
+		return nil, err
+	}
+	res = unwrapPriority(res)
+	if err := cp.record(stage, salt, item, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (cp *Checkpoint) record(stage, salt string, item, res interface{}) error {
+	rec := checkpointRecord{Stage: stage, Salt: salt, ID: itemID(item)}
+	switch v := res.(type) {
+	case int:
+		rec.Int = &v
+	case string:
+		rec.Str = &v
+	default:
+		return fmt.Errorf("cannot checkpoint %T", res)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if _, err := cp.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	cp.done[checkpointKey(stage, salt, rec.ID)] = res
+	return nil
+}
+
+func (cp *Checkpoint) Close() error {
+	if err := cp.file.Sync(); err != nil {
+		cp.file.Close()
+		return err
+	}
+	return cp.file.Close()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	withFastSigners(t)
+	path := filepath.Join(t.TempDir(), "run.log")
+
+	calls := 0
+	countingHash := func(item interface{}) (interface{}, error) {
+		calls++
+		return SingleHashItem(item)
+	}
+	runSigner := func(n int) string {
+		cp, err := OpenCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cp.Close()
+
+		var res string
+		jobs := signerJobs(n, &res)
+		// последовательно, чтобы считать вызовы без гонок
+		jobs[1] = job(func(in, out chan interface{}) {
+			fn := cp.Item("single", countingHash)
+			for item := range in {
+				res, err := fn(item)
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				out <- res
+			}
+		})
+		ExecutePipeline(jobs...)
+		return res
+	}
+
+	first := runSigner(5)
+	if calls != 5 {
+		t.Errorf("wrong number of calls on first run\nGot: %d\nExpected: 5", calls)
+	}
+
+	// имитируем падение посреди записи
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"stage":"single","id":"int:7","str":"12`)
+	f.Close()
+
+	calls = 0
+	second := runSigner(8)
+	if calls != 3 {
+		t.Errorf("completed items processed again\nGot: %d calls\nExpected: 3", calls)
+	}
+
+	var expected string
+	ExecutePipeline(signerJobs(8, &expected)...)
+	if second != expected || first == second {
+		t.Errorf("resumed result differs\nGot: %v\nExpected: %v", second, expected)
+	}
+
+	cp, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	if cp.Len() != 8 {
+		t.Errorf("wrong number of records\nGot: %d\nExpected: 8", cp.Len())
+	}
+}
+
+func TestCheckpointSettings(t *testing.T) {
+	withFastSigners(t)
+	t.Cleanup(func() { DataSignerSalt = "" })
+	path := filepath.Join(t.TempDir(), "run.log")
+
+	// повторный запуск с другой солью или схемой не должен брать старые подписи
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "4108050209~502633748\n"},
+		{[]string{"-salt", "x"}, "3225541890~2391274616\n"},
+		{[]string{"-scheme", "sep=-"}, "4108050209-502633748\n"},
+		{[]string{"-salt", "x"}, "3225541890~2391274616\n"},
+	} {
+		DataSignerSalt = ""
+		out := new(bytes.Buffer)
+		args := append([]string{"-chain", "single", "-checkpoint", path}, c.args...)
+		if err := run(args, strings.NewReader("0\n"), out); err != nil || out.String() != c.expected {
+			t.Errorf("%v\nGot: %v (%v)\nExpected: %v", c.args, out.String(), err, c.expected)
+		}
+	}
+
+	cp, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	if cp.Len() != 3 {
+		t.Errorf("wrong number of records\nGot: %d\nExpected: 3", cp.Len())
+	}
+}
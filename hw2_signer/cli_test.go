@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCLI(t *testing.T) {
+	withFastSigners(t)
+
+	// значения из примера в hw2.md
+	out := new(bytes.Buffer)
+	err := run(nil, strings.NewReader("0\n\n1\n"), out)
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542\n"
+	if err != nil || out.String() != expected {
+		t.Errorf("results not match\nGot: %v (%v)\nExpected: %v", out.String(), err, expected)
+	}
+
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	err = run([]string{"-chain", "single", "-format", "jsonl", path}, nil, out)
+	expected = `{"result":"4108050209~502633748"}` + "\n"
+	if err != nil || out.String() != expected {
+		t.Errorf("results not match\nGot: %v (%v)\nExpected: %v", out.String(), err, expected)
+	}
+
+	out.Reset()
+	err = run([]string{"-chain", "single", "-lines"}, strings.NewReader("0\n"), out)
+	if err != nil || out.String() != "4108050209~502633748\n" {
+		t.Errorf("lines input not signed as strings\nGot: %v (%v)", out.String(), err)
+	}
+
+	if err := run([]string{"-chain", "single,unknown"}, nil, out); err == nil {
+		t.Errorf("expected error for unknown stage")
+	}
+	// ошибка во входе находится до того, как что-то выведено
+	out.Reset()
+	if err := run([]string{"-chain", "single"}, strings.NewReader("0\nabc\n1\n"), out); err == nil || out.Len() != 0 {
+		t.Errorf("expected error and no output for non-number input, got %v %q", err, out.String())
+	}
+}
+
+func TestCLIWorker(t *testing.T) {
+	withFastSigners(t)
+
+	for _, args := range [][]string{
+		{"-worker", "unix:/tmp/x.sock"},
+		{"-worker", "combine=unix:/tmp/x.sock"},
+		{"-worker", "multi=unix:/tmp/x.sock", "input.txt"},
+	} {
+		if err := run(args, nil, new(bytes.Buffer)); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+
+	// стадия воркера не зависит от -chain
+	addr := "unix:" + filepath.Join(t.TempDir(), "multi.sock")
+	go run([]string{"-worker", "multi=" + addr}, nil, new(bytes.Buffer))
+	var rs *RemoteStage
+	var err error
+	for i := 0; i < 100; i++ {
+		if rs, err = DialStage(addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	res, err := rs.Item("4108050209~502633748")
+	expected, _ := MultiHashItem("4108050209~502633748")
+	if err != nil || res != expected {
+		t.Errorf("wrong worker result\nGot: %v (%v)\nExpected: %v", res, err, expected)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the signers, OverheatLock, signer retries and CombineWindowed.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a *time.Timer of a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop and Reset work like those of *time.Timer
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SignerClock is the real clock unless a test replaces it.
+var SignerClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type fakeSleeper struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// FakeClock is a simulated clock: time only moves with Advance, or on its own with AutoAdvance.
+type FakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	sleepers []fakeSleeper
+	// added gets a signal whenever a goroutine starts waiting
+	added chan struct{}
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start, added: make(chan struct{}, 1)}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{c: c, ch: make(chan time.Time, 1)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.start(t.ch, d)
+	return t
+}
+
+// start makes ch get the time after d
+func (c *FakeClock) start(ch chan time.Time, d time.Duration) {
+	if d <= 0 {
+		select {
+		case ch <- c.now:
+		default:
+		}
+		return
+	}
+	c.sleepers = append(c.sleepers, fakeSleeper{until: c.now.Add(d), ch: ch})
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+}
+
+// stop removes the sleeper waiting on ch, it returns false if there is none
+func (c *FakeClock) stop(ch chan time.Time) bool {
+	for i, s := range c.sleepers {
+		if s.ch == ch {
+			c.sleepers = append(c.sleepers[:i], c.sleepers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	c  *FakeClock
+	ch chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	return t.c.stop(t.ch)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	active := t.c.stop(t.ch)
+	t.c.start(t.ch, d)
+	return active
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Sleepers returns the number of goroutines and timers waiting for the clock.
+func (c *FakeClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// Advance moves the clock forward by d and wakes everyone whose time has come.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setTime(c.now.Add(d))
+}
+
+// AdvanceToNext moves the clock to the earliest deadline of the waiting goroutines.
+// It returns false if nobody waits.
+func (c *FakeClock) AdvanceToNext() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.sleepers) == 0 {
+		return false
+	}
+	next := c.sleepers[0].until
+	for _, s := range c.sleepers[1:] {
+		if s.until.Before(next) {
+			next = s.until
+		}
+	}
+	c.setTime(next)
+	return true
+}
+
+func (c *FakeClock) setTime(t time.Time) {
+	c.now = t
+	// wake in deadline order, so the woken goroutines get the order they would have in real time
+	sort.SliceStable(c.sleepers, func(i, j int) bool {
+		return c.sleepers[i].until.Before(c.sleepers[j].until)
+	})
+	n := 0
+	for _, s := range c.sleepers {
+		if s.until.After(t) {
+			break
+		}
+		// like a *time.Timer, a time nobody took yet is not replaced
+		select {
+		case s.ch <- t:
+		default:
+		}
+		n++
+	}
+	c.sleepers = c.sleepers[n:]
+}
+
+// AutoAdvance starts moving the clock to the next deadline every time all goroutines
+// are blocked and some of them wait for the clock, so simulated time passes only when
+// nothing else can happen. wait must return once every other goroutine is blocked,
+// like synctest.Wait does in a testing/synctest bubble the clock is created in.
+func (c *FakeClock) AutoAdvance(wait func()) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			wait()
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if c.AdvanceToNext() {
+				continue
+			}
+			// nobody waits for the clock yet
+			select {
+			case <-done:
+				return
+			case <-c.added:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
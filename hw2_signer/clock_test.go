@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+// функции из common.go в том виде, в каком они были до подмены в TestSigner
+var (
+	commonOverheatLock    = OverheatLock
+	commonOverheatUnlock  = OverheatUnlock
+	commonDataSignerMd5   = DataSignerMd5
+	commonDataSignerCrc32 = DataSignerCrc32
+)
+
+// withFakeClock подставляет функции из common.go, работающие на симулированных часах.
+// Вызывается внутри synctest.Test: часы идут, только когда все горутины заблокированы
+func withFakeClock(t *testing.T) *FakeClock {
+	clock := NewFakeClock(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	stop := clock.AutoAdvance(synctest.Wait)
+
+	origClock := SignerClock
+	origLock, origUnlock := OverheatLock, OverheatUnlock
+	origMd5, origCrc32 := DataSignerMd5, DataSignerCrc32
+	SignerClock = clock
+	OverheatLock, OverheatUnlock = commonOverheatLock, commonOverheatUnlock
+	DataSignerMd5, DataSignerCrc32 = commonDataSignerMd5, commonDataSignerCrc32
+	t.Cleanup(func() {
+		stop()
+		SignerClock = origClock
+		OverheatLock, OverheatUnlock = origLock, origUnlock
+		DataSignerMd5, DataSignerCrc32 = origMd5, origCrc32
+	})
+	return clock
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	woken := make(chan time.Duration, 2)
+	for _, d := range []time.Duration{2 * time.Second, time.Second} {
+		go func(d time.Duration) {
+			clock.Sleep(d)
+			woken <- d
+		}(d)
+	}
+	for clock.Sleepers() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if d := <-woken; d != time.Second {
+		t.Errorf("wrong sleeper woken: %s", d)
+	}
+	if !clock.AdvanceToNext() || clock.Now() != (time.Time{}).Add(2*time.Second) {
+		t.Errorf("clock not moved to next deadline: %s", clock.Now())
+	}
+	if d := <-woken; d != 2*time.Second {
+		t.Errorf("wrong sleeper woken: %s", d)
+	}
+	if clock.AdvanceToNext() {
+		t.Errorf("advanced without sleepers")
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	timer := clock.NewTimer(time.Second)
+	if !timer.Stop() || timer.Stop() || clock.Sleepers() != 0 {
+		t.Errorf("timer not stopped")
+	}
+
+	timer.Reset(time.Second)
+	clock.Advance(time.Second)
+	// сработавший и не прочитанный таймер: Stop возвращает false, значение надо вычитать
+	if timer.Stop() {
+		t.Errorf("fired timer stopped")
+	}
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("fired timer has no value")
+	}
+	if timer.Reset(time.Second) {
+		t.Errorf("fired timer was active")
+	}
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Errorf("reset timer fired early")
+	default:
+	}
+	clock.Advance(500 * time.Millisecond)
+	if now := <-timer.C(); now != (time.Time{}).Add(2*time.Second) {
+		t.Errorf("wrong fire time: %s", now)
+	}
+}
+
+func TestSignerSimulated(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		clock := withFakeClock(t)
+
+		var result string
+		start := clock.Now()
+		ExecutePipeline(signerJobs(7, &result)...)
+		elapsed := clock.Now().Sub(start)
+
+		// 1 сек на SingleHash + 1 сек на MultiHash, 7 md5 считаются по очереди по 10 мс
+		if elapsed != 2070*time.Millisecond {
+			t.Errorf("simulated execution time\nGot: %s\nExpected: 2.07s", elapsed)
+		}
+
+		var expected string
+		withFastSigners(t)
+		ExecutePipeline(signerJobs(7, &expected)...)
+		if result != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+type splitKind int
+
+const (
+	splitBroadcast splitKind = iota
+	splitRoundRobin
+	splitKeyed
+)
+
+func (k splitKind) String() string {
+	return [...]string{"broadcast", "round-robin", "keyed"}[k]
+}
+
+type graphSplit struct {
+	kind splitKind
+	to   []string
+	key  func(item interface{}) string
+}
+
+type graphNode struct {
+	name   string
+	job    job
+	split  *graphSplit
+	inputs int
+}
+
+// Graph wires named jobs into a DAG. Every node has one input and one output channel:
+// a node with several incoming edges reads the merged stream of all of them,
+// the output of a node is split over its targets by one of Broadcast, RoundRobin or Partition.
+// Nodes without incoming edges get an empty input, outputs of nodes without
+// outgoing edges are discarded.
+//
+// Wiring mistakes are collected and reported by Validate and Run.
+type Graph struct {
+	nodes map[string]*graphNode
+	order []string
+	errs  []error
+}
+
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*graphNode)}
+}
+
+func (g *Graph) errorf(format string, args ...interface{}) {
+	g.errs = append(g.errs, fmt.Errorf(format, args...))
+}
+
+// Node adds a named job.
+func (g *Graph) Node(name string, j job) *Graph {
+	if _, ok := g.nodes[name]; ok {
+		g.errorf("node %q added twice", name)
+		return g
+	}
+	if j == nil {
+		g.errorf("node %q has no job", name)
+	}
+	g.nodes[name] = &graphNode{name: name, job: j}
+	g.order = append(g.order, name)
+	return g
+}
+
+// Merge adds a node that passes through everything it gets from its incoming edges.
+func (g *Graph) Merge(name string) *Graph {
+	return g.Node(name, func(in, out chan interface{}) {
+		for item := range in {
+			out <- item
+		}
+	})
+}
+
+// Broadcast sends every output item of from to all of to.
+func (g *Graph) Broadcast(from string, to ...string) *Graph {
+	return g.connect(from, &graphSplit{kind: splitBroadcast, to: to})
+}
+
+// RoundRobin sends output items of from to each of to in turn.
+func (g *Graph) RoundRobin(from string, to ...string) *Graph {
+	return g.connect(from, &graphSplit{kind: splitRoundRobin, to: to})
+}
+
+// Partition sends each output item of from to one of to chosen by the hash of key(item),
+// so items with equal keys always go to the same node.
+func (g *Graph) Partition(from string, key func(item interface{}) string, to ...string) *Graph {
+	if key == nil {
+		g.errorf("partition of %q has no key function", from)
+	}
+	return g.connect(from, &graphSplit{kind: splitKeyed, to: to, key: key})
+}
+
+func (g *Graph) connect(from string, split *graphSplit) *Graph {
+	node, ok := g.nodes[from]
+	if !ok {
+		g.errorf("%s edge from unknown node %q", split.kind, from)
+		return g
+	}
+	if node.split != nil {
+		g.errorf("node %q already has %s edges, a node can only be split once", from, node.split.kind)
+		return g
+	}
+	if len(split.to) == 0 {
+		g.errorf("%s edge from %q has no targets", split.kind, from)
+		return g
+	}
+	seen := make(map[string]bool, len(split.to))
+	for _, to := range split.to {
+		if _, ok := g.nodes[to]; !ok {
+			g.errorf("%s edge from %q to unknown node %q", split.kind, from, to)
+			return g
+		}
+		if seen[to] {
+			g.errorf("%s edge from %q lists %q twice", split.kind, from, to)
+			return g
+		}
+		seen[to] = true
+	}
+	node.split = split
+	return g
+}
+
+// Validate reports wiring mistakes and cycles.
+func (g *Graph) Validate() error {
+	errs := append([]error(nil), g.errs...)
+	if len(g.nodes) == 0 {
+		errs = append(errs, errors.New("graph has no nodes"))
+	}
+	if cycle := g.findCycle(); cycle != nil {
+		errs = append(errs, fmt.Errorf("cycle: %s", strings.Join(cycle, " -> ")))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid graph: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (g *Graph) findCycle() []string {
+	const (
+		unvisited = iota
+		inPath
+		done
+	)
+	state := make(map[string]int, len(g.nodes))
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = inPath
+		path = append(path, name)
+		if split := g.nodes[name].split; split != nil {
+			for _, to := range split.to {
+				switch state[to] {
+				case inPath:
+					for i, n := range path {
+						if n == to {
+							return append(append([]string(nil), path[i:]...), to)
+						}
+					}
+				case unvisited:
+					if cycle := visit(to); cycle != nil {
+						return cycle
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, name := range g.order {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// Run validates the graph and runs all nodes until every one of them has finished.
+func (g *Graph) Run() error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	for _, node := range g.nodes {
+		node.inputs = 0
+	}
+	for _, node := range g.nodes {
+		if node.split != nil {
+			for _, to := range node.split.to {
+				g.nodes[to].inputs++
+			}
+		}
+	}
+
+	ins := make(map[string]chan interface{}, len(g.nodes))
+	pending := make(map[string]*sync.WaitGroup, len(g.nodes))
+	for _, name := range g.order {
+		ins[name] = make(chan interface{})
+		pending[name] = &sync.WaitGroup{}
+		pending[name].Add(g.nodes[name].inputs)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, name := range g.order {
+		node := g.nodes[name]
+		in, out := ins[name], make(chan interface{})
+
+		// input is closed once every upstream node has finished
+		go func(in chan interface{}, pending *sync.WaitGroup) {
+			pending.Wait()
+			close(in)
+		}(in, pending[name])
+
+		wg.Add(2)
+		go func(node *graphNode, in, out chan interface{}) {
+			defer wg.Done()
+			node.job(in, out)
+			close(out)
+		}(node, in, out)
+		go func(split *graphSplit, out chan interface{}) {
+			defer wg.Done()
+			g.dispatch(split, out, ins, pending)
+		}(node.split, out)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (g *Graph) dispatch(split *graphSplit, out chan interface{}, ins map[string]chan interface{}, pending map[string]*sync.WaitGroup) {
+	if split == nil {
+		for range out {
+		}
+		return
+	}
+	next := 0
+	for item := range out {
+		switch split.kind {
+		case splitBroadcast:
+			for _, to := range split.to {
+				ins[to] <- item
+			}
+		case splitRoundRobin:
+			ins[split.to[next]] <- item
+			next = (next + 1) % len(split.to)
+		case splitKeyed:
+			h := fnv.New32a()
+			h.Write([]byte(split.key(item)))
+			ins[split.to[h.Sum32()%uint32(len(split.to))]] <- item
+		}
+	}
+	for _, to := range split.to {
+		pending[to].Done()
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	withFastSigners(t)
+
+	var audit []string
+	var result string
+	err := NewGraph().
+		Node("source", func(in, out chan interface{}) {
+			for _, n := range []int{0, 1} {
+				out <- n
+			}
+		}).
+		Node("single", SingleHash).
+		Node("multi", MultiHash).
+		Node("audit", func(in, out chan interface{}) {
+			for item := range in {
+				audit = append(audit, strconv.Itoa(item.(int)))
+				out <- "audit:" + strconv.Itoa(item.(int))
+			}
+		}).
+		Merge("merge").
+		Node("combine", CombineResults).
+		Node("sink", func(in, out chan interface{}) {
+			for item := range in {
+				result = item.(string)
+			}
+		}).
+		Broadcast("source", "single", "audit").
+		Broadcast("single", "multi").
+		Broadcast("multi", "merge").
+		Broadcast("audit", "merge").
+		Broadcast("merge", "combine").
+		Broadcast("combine", "sink").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542_audit:0_audit:1"
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	if strings.Join(audit, ",") != "0,1" {
+		t.Errorf("audit stage got %v", audit)
+	}
+}
+
+func TestGraphPartition(t *testing.T) {
+	mu := &sync.Mutex{}
+	got := map[string][]int{}
+	collect := func(name string) job {
+		return func(in, out chan interface{}) {
+			for item := range in {
+				mu.Lock()
+				got[name] = append(got[name], item.(int))
+				mu.Unlock()
+			}
+		}
+	}
+	source := func(in, out chan interface{}) {
+		for i := 0; i < 6; i++ {
+			out <- i
+		}
+	}
+
+	err := NewGraph().
+		Node("source", source).
+		Node("a", collect("a")).
+		Node("b", collect("b")).
+		RoundRobin("source", "a", "b").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got["a"]) != 3 || len(got["b"]) != 3 {
+		t.Errorf("round robin not even: %v", got)
+	}
+
+	got = map[string][]int{}
+	err = NewGraph().
+		Node("source", source).
+		Node("a", collect("a")).
+		Node("b", collect("b")).
+		Partition("source", func(item interface{}) string {
+			return strconv.Itoa(item.(int) % 2)
+		}, "a", "b").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, items := range got {
+		sort.Ints(items)
+		for _, item := range items {
+			if item%2 != items[0]%2 {
+				t.Errorf("items with different keys in one partition: %v", got)
+			}
+		}
+	}
+}
+
+func TestGraphErrors(t *testing.T) {
+	noop := job(func(in, out chan interface{}) {})
+
+	err := NewGraph().
+		Node("a", noop).Node("b", noop).Node("c", noop).
+		Broadcast("a", "b").Broadcast("b", "c").Broadcast("c", "a").
+		Validate()
+	if err == nil || !strings.Contains(err.Error(), "cycle: a -> b -> c -> a") {
+		t.Errorf("cycle not reported: %v", err)
+	}
+
+	err = NewGraph().
+		Node("a", noop).Node("a", noop).
+		Broadcast("a", "missing").
+		RoundRobin("nope", "a").
+		Run()
+	for _, msg := range []string{
+		`node "a" added twice`,
+		`broadcast edge from "a" to unknown node "missing"`,
+		`round-robin edge from unknown node "nope"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("error %q not reported: %v", msg, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Хелперы для проверки цепочек job. Запускать в CI как go test -race.
+// checkPipeline гоняет цепочку через Pipeline.Execute и после этого проверяет,
+// что не осталось висящих горутин и что все каналы между функциями закрыты и пусты.
+
+// leakTimeout - сколько ждем завершения горутин после ExecutePipeline
+var leakTimeout = 2 * time.Second
+
+// goroutines возвращает стеки всех горутин по их id
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	res := map[string]string{}
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		header := strings.Fields(string(g))
+		if len(header) > 1 && header[0] == "goroutine" {
+			res[header[1]] = string(g)
+		}
+	}
+	return res
+}
+
+// checkNoLeaks проверяет, что все горутины, которых не было в before, завершились
+func checkNoLeaks(t testing.TB, before map[string]string) {
+	t.Helper()
+	var leaked []string
+	for deadline := time.Now().Add(leakTimeout); ; {
+		leaked = leaked[:0]
+		for id, stack := range goroutines() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+// chanState смотрит на канал без блокировки
+func chanState(ch chan interface{}) string {
+	select {
+	case item, ok := <-ch:
+		if !ok {
+			return "closed"
+		}
+		return fmt.Sprintf("has unread item %v", item)
+	default:
+		return "open"
+	}
+}
+
+// checkPipeline запускает jobs и проверяет утечки горутин и закрытие каналов
+func checkPipeline(t testing.TB, p *Pipeline, jobs ...job) error {
+	t.Helper()
+	before := goroutines()
+
+	mu := &sync.Mutex{}
+	ins := make([]chan interface{}, len(jobs))
+	outs := make([]chan interface{}, len(jobs))
+	wrapped := make([]job, len(jobs))
+	for i, j := range jobs {
+		i, j := i, j
+		wrapped[i] = func(in, out chan interface{}) {
+			mu.Lock()
+			ins[i], outs[i] = in, out
+			mu.Unlock()
+			j(in, out)
+		}
+	}
+
+	err := p.Execute(wrapped...)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range jobs {
+		if ins[i] == nil {
+			t.Errorf("stage %d was not started", i)
+			continue
+		}
+		if state := chanState(ins[i]); state != "closed" {
+			t.Errorf("input of stage %d %s after pipeline end", i, state)
+		}
+		if state := chanState(outs[i]); state != "closed" {
+			t.Errorf("output of stage %d %s after pipeline end", i, state)
+		}
+	}
+	checkNoLeaks(t, before)
+	return err
+}
+
+func TestHarnessSigner(t *testing.T) {
+	withFastSigners(t)
+
+	var result string
+	if err := checkPipeline(t, &Pipeline{}, signerJobs(MaxInputDataLen, &result)...); err != nil {
+		t.Error(err)
+	}
+	if err := checkPipeline(t, &Pipeline{Buffers: []int{3, 3, 3}, Overflow: OverflowDrop}, signerJobs(20, &result)...); err != nil {
+		t.Error(err)
+	}
+	if err := checkPipeline(t, &Pipeline{OnPanic: PanicFail}, job(func(in, out chan interface{}) {
+		out <- 1
+	}), MultiHash); err == nil {
+		t.Error("expected panic error")
+	}
+}
+
+func TestHarnessDetectsLeak(t *testing.T) {
+	defer func(timeout time.Duration) { leakTimeout = timeout }(leakTimeout)
+	leakTimeout = 100 * time.Millisecond
+
+	release := make(chan struct{})
+	ft := &fakeT{}
+	checkPipeline(ft, &Pipeline{}, job(func(in, out chan interface{}) {
+		go func() { <-release }()
+	}))
+	close(release)
+	if !ft.failed || !strings.Contains(ft.msg, "goroutines leaked") {
+		t.Errorf("leak not detected: %q", ft.msg)
+	}
+}
+
+// fakeT собирает ошибки хелперов, чтобы проверить сами хелперы
+type fakeT struct {
+	testing.TB
+	failed bool
+	msg    string
+}
+
+func (f *fakeT) Helper() {}
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failed = true
+	f.msg += fmt.Sprintf(format, args...)
+}
+
+// fuzzStages - функции над int, которые фаззер расставляет в произвольном порядке.
+// ref - то же самое без каналов, для сверки
+var fuzzStages = []struct {
+	name string
+	job  job
+	ref  func([]int) []int
+}{
+	{"inc", Parallel(func(item interface{}) (interface{}, error) {
+		return item.(int) + 1, nil
+	}, nil), func(items []int) []int {
+		res := []int{}
+		for _, i := range items {
+			res = append(res, i+1)
+		}
+		return res
+	}},
+	{"double", func(in, out chan interface{}) {
+		for item := range in {
+			out <- item.(int) * 2
+		}
+	}, func(items []int) []int {
+		res := []int{}
+		for _, i := range items {
+			res = append(res, i*2)
+		}
+		return res
+	}},
+	{"dropOdd", func(in, out chan interface{}) {
+		for item := range in {
+			if item.(int)%2 == 0 {
+				out <- item
+			}
+		}
+	}, func(items []int) []int {
+		res := []int{}
+		for _, i := range items {
+			if i%2 == 0 {
+				res = append(res, i)
+			}
+		}
+		return res
+	}},
+	{"dup", func(in, out chan interface{}) {
+		for item := range in {
+			out <- item
+			out <- item
+		}
+	}, func(items []int) []int {
+		res := []int{}
+		for _, i := range items {
+			res = append(res, i, i)
+		}
+		return res
+	}},
+}
+
+func FuzzPipeline(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3}, []byte{1, 2, 3, 5, 8})
+	f.Add([]byte{3, 3, 0}, []byte{})
+	f.Add([]byte{}, []byte{255, 0, 7})
+
+	f.Fuzz(func(t *testing.T, order []byte, input []byte) {
+		if len(order) > 8 || len(input) > MaxInputDataLen {
+			t.Skip()
+		}
+
+		expected := []int{}
+		for _, b := range input {
+			expected = append(expected, int(b))
+		}
+		jobs := []job{job(func(in, out chan interface{}) {
+			for _, b := range input {
+				out <- int(b)
+			}
+		})}
+		var names []string
+		for _, o := range order {
+			s := fuzzStages[int(o)%len(fuzzStages)]
+			jobs = append(jobs, s.job)
+			expected = s.ref(expected)
+			names = append(names, s.name)
+		}
+		got := []int{}
+		jobs = append(jobs, job(func(in, out chan interface{}) {
+			for item := range in {
+				got = append(got, item.(int))
+			}
+		}))
+
+		buffers := make([]int, len(order))
+		for i, o := range order {
+			buffers[i] = int(o) / len(fuzzStages) % 4
+		}
+		if err := checkPipeline(t, &Pipeline{Buffers: buffers}, jobs...); err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Ints(got)
+		sort.Ints(expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("stages %v, buffers %v\nGot: %v\nExpected: %v", names, buffers, got, expected)
+		}
+	})
+}
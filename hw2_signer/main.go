@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stages are the jobs that can be put in a chain with -chain
+var stages = map[string]job{
+	"single":  SingleHash,
+	"multi":   MultiHash,
+	"combine": CombineResults,
+}
+
+// itemStages are the stages that can run in worker processes
+var itemStages = map[string]ItemFunc{
+	"single": SingleHashItem,
+	"multi":  MultiHashItem,
+}
+
+// remoteFlags collects -remote stage=addr,addr values
+type remoteFlags map[string][]string
+
+func (r remoteFlags) String() string {
+	return fmt.Sprint(map[string][]string(r))
+}
+
+func (r remoteFlags) Set(value string) error {
+	stage, addrs, ok := strings.Cut(value, "=")
+	if !ok || addrs == "" {
+		return fmt.Errorf("expected stage=addr[,addr...], got %q", value)
+	}
+	if _, ok := itemStages[stage]; !ok {
+		return fmt.Errorf("stage %q cannot run remotely", stage)
+	}
+	r[stage] = append(r[stage], strings.Split(addrs, ",")...)
+	return nil
+}
+
+// progressOut receives -progress reports
+var progressOut io.Writer = os.Stderr
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("signer", flag.ContinueOnError)
+	chain := flags.String("chain", "single,multi,combine", "comma separated stages: single, multi, combine")
+	format := flags.String("format", "text", "output format: text or jsonl")
+	lines := flags.Bool("lines", false, "sign input lines as strings instead of parsing them as numbers")
+	flags.StringVar(&DataSignerSalt, "salt", DataSignerSalt, "salt added to every signed value")
+	worker := flags.String("worker", "", "serve a stage on an address instead of reading input: stage=addr, addr is unix:/path or tcp:host:port")
+	remotes := remoteFlags{}
+	flags.Var(remotes, "remote", "run stage on workers: stage=addr[,addr...], can be repeated")
+	schemeSpec := flags.String("scheme", "", "signature scheme, e.g. \"rounds=3; sep=-; order=reverse\", see Scheme for the keys")
+	checkpoint := flags.String("checkpoint", "", "log processed items to this file and skip the ones already logged by a previous run")
+	progress := flags.Duration("progress", 0, "report progress to stderr at this interval, a bar on a terminal and JSON lines otherwise")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: signer [flags] [file ...]\nreads stdin if no files or - given")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "jsonl" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var scheme *Scheme
+	if *schemeSpec != "" {
+		var err error
+		if scheme, err = ParseScheme(*schemeSpec); err != nil {
+			return err
+		}
+	}
+
+	if *worker != "" {
+		if flags.NArg() != 0 {
+			return errors.New("-worker reads no input files")
+		}
+		stage, addr, ok := strings.Cut(*worker, "=")
+		if !ok || addr == "" {
+			return fmt.Errorf("-worker: expected stage=addr, got %q", *worker)
+		}
+		return serveWorker(addr, stage, scheme)
+	}
+
+	opts := chainOptions{remotes: remotes, scheme: scheme}
+	if *checkpoint != "" {
+		cp, err := OpenCheckpoint(*checkpoint)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		opts.checkpoint = cp
+	}
+
+	jobs, closeRemotes, err := chainJobs(*chain, opts)
+	if err != nil {
+		return err
+	}
+	defer closeRemotes()
+
+	// bad input is reported before anything is signed or printed
+	inputs, err := openInputs(flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	items, err := readItems(inputs, *lines)
+	closeInputs(inputs)
+	if err != nil {
+		return err
+	}
+
+	var writeErr error
+	source := job(func(in, out chan interface{}) {
+		for _, item := range items {
+			out <- item
+		}
+	})
+	sink := job(func(in, out chan interface{}) {
+		w := bufio.NewWriter(stdout)
+		for item := range in {
+			if writeErr == nil {
+				writeErr = writeItem(w, item, *format)
+			}
+		}
+		if err := w.Flush(); writeErr == nil {
+			writeErr = err
+		}
+	})
+
+	p := &Pipeline{}
+	if *progress > 0 {
+		// the last signing stage tells how many items are done
+		track := 0
+		for i, stage := range strings.Split(*chain, ",") {
+			if _, ok := itemStages[strings.TrimSpace(stage)]; ok {
+				track = i + 1
+			}
+		}
+		pr := NewProgress(track, len(items))
+		p.Observer = pr
+		stop := pr.Report(progressOut, *progress)
+		defer stop()
+	}
+	err = p.Execute(append(append([]job{source}, jobs...), sink)...)
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
+
+type chainOptions struct {
+	remotes    remoteFlags
+	checkpoint *Checkpoint
+	scheme     *Scheme
+}
+
+// stagesOf returns the stages of scheme, or the default ones if scheme is nil.
+func stagesOf(scheme *Scheme) (map[string]job, map[string]ItemFunc) {
+	if scheme == nil {
+		return stages, itemStages
+	}
+	single, multi, combine := scheme.Jobs()
+	return map[string]job{"single": single, "multi": multi, "combine": combine},
+		map[string]ItemFunc{"single": scheme.SingleItem, "multi": scheme.MultiItem}
+}
+
+func chainJobs(chain string, opts chainOptions) ([]job, func(), error) {
+	var jobs []job
+	var dialed []*RemoteStage
+	jobsByName, itemsByName := stagesOf(opts.scheme)
+	closeRemotes := func() {
+		for _, rs := range dialed {
+			rs.Close()
+		}
+	}
+	for _, name := range strings.Split(chain, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		j, ok := jobsByName[name]
+		if !ok {
+			closeRemotes()
+			return nil, nil, fmt.Errorf("unknown stage %q", name)
+		}
+		fn, isItemStage := itemsByName[name]
+		if addrs, ok := opts.remotes[name]; ok {
+			rs, err := DialStage(addrs...)
+			if err != nil {
+				closeRemotes()
+				return nil, nil, err
+			}
+			dialed = append(dialed, rs)
+			fn = rs.Item
+			j = Parallel(fn, nil)
+		}
+		if opts.checkpoint != nil && isItemStage {
+			stage := name
+			if opts.scheme != nil {
+				stage += " " + opts.scheme.String()
+			}
+			j = Parallel(opts.checkpoint.Item(stage, fn), nil)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, closeRemotes, nil
+}
+
+func serveWorker(addr, stage string, scheme *Scheme) error {
+	_, itemsByName := stagesOf(scheme)
+	fn, ok := itemsByName[stage]
+	if !ok {
+		return fmt.Errorf("stage %q cannot run as a worker", stage)
+	}
+	network, address := ParseAddr(addr)
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	Logger.Info("worker started", "stage", stage, "addr", addr)
+	return ServeStage(l, fn)
+}
+
+type input struct {
+	name string
+	r    io.Reader
+	file *os.File // nil for stdin
+}
+
+func openInputs(paths []string, stdin io.Reader) ([]input, error) {
+	if len(paths) == 0 {
+		return []input{{name: "stdin", r: stdin}}, nil
+	}
+	inputs := make([]input, 0, len(paths))
+	for _, path := range paths {
+		if path == "-" {
+			inputs = append(inputs, input{name: "stdin", r: stdin})
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			closeInputs(inputs)
+			return nil, err
+		}
+		inputs = append(inputs, input{name: path, r: f, file: f})
+	}
+	return inputs, nil
+}
+
+func closeInputs(inputs []input) {
+	for _, in := range inputs {
+		if in.file != nil {
+			in.file.Close()
+		}
+	}
+}
+
+// readItems returns every non-empty line of inputs, as int unless asStrings is set.
+func readItems(inputs []input, asStrings bool) ([]interface{}, error) {
+	var items []interface{}
+	for _, in := range inputs {
+		scanner := bufio.NewScanner(in.r)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if asStrings {
+				items = append(items, line)
+				continue
+			}
+			num, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", in.name, n, err)
+			}
+			items = append(items, num)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func writeItem(w io.Writer, item interface{}, format string) error {
+	if format == "jsonl" {
+		line, err := json.Marshal(struct {
+			Result interface{} `json:"result"`
+		}{item})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", line)
+		return err
+	}
+	_, err := fmt.Fprintln(w, item)
+	return err
+}
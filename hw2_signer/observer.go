@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Logger receives the debug output of the signer stages. Debug level is off by default.
+var Logger = slog.Default()
+
+// Observer gets events from Pipeline.Execute. Stages are numbered by their position in the job list.
+// queueDepth is the number of items buffered in the input channel of the stage after the item was put in it.
+// Methods are called concurrently from different stages.
+type Observer interface {
+	StageStart(stage int)
+	ItemIn(stage int, item interface{}, queueDepth int)
+	ItemOut(stage int, item interface{})
+	StageDone(stage int, elapsed time.Duration)
+}
+
+type stageMetrics struct {
+	running    bool
+	itemsIn    uint64
+	itemsOut   uint64
+	queueDepth int
+	started    time.Time
+	duration   time.Duration
+}
+
+// Metrics is an Observer that collects per-stage counters and exports them
+// in the Prometheus text format.
+type Metrics struct {
+	mu     sync.Mutex
+	stages []stageMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) stage(i int) *stageMetrics {
+	for len(m.stages) <= i {
+		m.stages = append(m.stages, stageMetrics{})
+	}
+	return &m.stages[i]
+}
+
+func (m *Metrics) StageStart(stage int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stage(stage)
+	s.running = true
+	s.started = time.Now()
+}
+
+func (m *Metrics) ItemIn(stage int, item interface{}, queueDepth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stage(stage)
+	s.itemsIn++
+	s.queueDepth = queueDepth
+}
+
+func (m *Metrics) ItemOut(stage int, item interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stage(stage)
+	s.itemsOut++
+}
+
+func (m *Metrics) StageDone(stage int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stage(stage)
+	s.running = false
+	s.duration = elapsed
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	stages := append([]stageMetrics(nil), m.stages...)
+	m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	metric := func(name, kind, help string, value func(s stageMetrics) float64) {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i, s := range stages {
+			fmt.Fprintf(cw, "%s{stage=\"%d\"} %g\n", name, i, value(s))
+		}
+	}
+	metric("signer_stage_items_in_total", "counter", "Items received by the stage.",
+		func(s stageMetrics) float64 { return float64(s.itemsIn) })
+	metric("signer_stage_items_out_total", "counter", "Items sent by the stage.",
+		func(s stageMetrics) float64 { return float64(s.itemsOut) })
+	metric("signer_stage_queue_depth", "gauge", "Items waiting in the stage input channel.",
+		func(s stageMetrics) float64 { return float64(s.queueDepth) })
+	metric("signer_stage_running", "gauge", "1 while the stage is running.",
+		func(s stageMetrics) float64 {
+			if s.running {
+				return 1
+			}
+			return 0
+		})
+	metric("signer_stage_duration_seconds", "gauge", "Run time of the stage, up to now if still running.",
+		func(s stageMetrics) float64 {
+			if s.running {
+				return time.Since(s.started).Seconds()
+			}
+			return s.duration.Seconds()
+		})
+
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP makes Metrics usable as a /metrics handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
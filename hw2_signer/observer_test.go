@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPipelineMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	p := &Pipeline{Observer: metrics}
+
+	var collected []interface{}
+	p.Execute(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 3; i++ {
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				out <- val.(int) * 2
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				collected = append(collected, val)
+			}
+		}),
+	)
+
+	if len(collected) != 3 {
+		t.Errorf("not all values passed the pipeline: %v", collected)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := metrics.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	res := buf.String()
+	for _, line := range []string{
+		`signer_stage_items_out_total{stage="0"} 3`,
+		`signer_stage_items_in_total{stage="1"} 3`,
+		`signer_stage_items_out_total{stage="1"} 3`,
+		`signer_stage_items_in_total{stage="2"} 3`,
+		`signer_stage_items_out_total{stage="2"} 0`,
+		`signer_stage_running{stage="2"} 0`,
+	} {
+		if !strings.Contains(res, line+"\n") {
+			t.Errorf("metric not found: %s\nGot:\n%s", line, res)
+		}
+	}
+}
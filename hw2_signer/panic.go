@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+type PanicPolicy int
+
+const (
+	// PanicFail stops feeding the panicked stage and makes Pipeline.Execute return the panic
+	PanicFail PanicPolicy = iota
+	// PanicSkip logs the panic of an item of a Parallel job and goes on with the next item.
+	// Other jobs keep state between items that a restart would lose, their panics fail
+	// the pipeline as under PanicFail.
+	PanicSkip
+)
+
+// PanicError is a recovered panic of a pipeline stage.
+type PanicError struct {
+	// Stage is the position of the job in the pipeline, -1 outside of a pipeline
+	Stage int
+	// Item is the item being processed. For jobs that don't process items one by one
+	// it is the last item handed to the stage, known only if items are relayed, see Pipeline.Execute.
+	Item  interface{}
+	Value interface{}
+	Stack []byte
+
+	// skippable is set by Parallel, the panic didn't lose anything but the item
+	skippable bool
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("stage %d panicked on item %v: %v", e.Stage, e.Item, e.Value)
+}
+
+// catchPanic runs fn and returns its panic, if any.
+// Panics that already are *PanicError are passed through.
+func catchPanic(fn func()) (perr *PanicError) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if e, ok := r.(*PanicError); ok {
+			perr = e
+			return
+		}
+		perr = &PanicError{Stage: -1, Value: r, Stack: debug.Stack()}
+	}()
+	fn()
+	return nil
+}
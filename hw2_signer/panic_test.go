@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelinePanic(t *testing.T) {
+	withFastSigners(t)
+
+	source := job(func(in, out chan interface{}) {
+		out <- "0~1"
+		out <- 42 // MultiHash ждет строку
+		out <- "2~3"
+	})
+	var collected []interface{}
+	collect := job(func(in, out chan interface{}) {
+		for item := range in {
+			collected = append(collected, item)
+		}
+	})
+
+	err := (&Pipeline{}).Execute(source, MultiHash, collect)
+	var perr *PanicError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *PanicError, got %v", err)
+	}
+	if perr.Stage != 1 || perr.Item != 42 || !strings.Contains(string(perr.Stack), "MultiHashItem") {
+		t.Errorf("wrong panic info: stage %d, item %v\n%s", perr.Stage, perr.Item, perr.Stack)
+	}
+
+	collected = nil
+	err = (&Pipeline{OnPanic: PanicSkip}).Execute(source, MultiHash, collect)
+	if err != nil || len(collected) != 2 {
+		t.Errorf("bad item not skipped: %v, collected %v", err, collected)
+	}
+
+	// паника в последовательной функции, ExecutePipeline не должен ронять тест
+	collected = nil
+	ExecutePipeline(source, job(func(in, out chan interface{}) {
+		for item := range in {
+			out <- item.(string)
+		}
+	}), collect)
+	if len(collected) != 1 {
+		t.Errorf("expected one item before the panic, got %v", collected)
+	}
+
+	// перезапуск последовательной функции потерял бы ее состояние, поэтому PanicSkip ее не пропускает
+	collected = nil
+	err = (&Pipeline{OnPanic: PanicSkip}).Execute(job(func(in, out chan interface{}) {
+		out <- "a"
+		out <- 42
+		out <- "b"
+	}), CombineResults, collect)
+	if !errors.As(err, &perr) || perr.Stage != 1 || len(collected) != 0 {
+		t.Errorf("panic of sequential stage skipped: %v, collected %v", err, collected)
+	}
+}
+
+func TestParallelPanicStops(t *testing.T) {
+	panicking := make(chan struct{})
+	failing := Parallel(func(item interface{}) (interface{}, error) {
+		if item == 1 {
+			close(panicking)
+			panic("boom")
+		}
+		return item, nil
+	}, nil)
+
+	in, out := make(chan interface{}), make(chan interface{}, 10)
+	done := make(chan *PanicError)
+	go func() {
+		done <- catchPanic(func() { failing(in, out) })
+	}()
+	in <- 0
+	in <- 1
+	<-panicking
+	time.Sleep(10 * time.Millisecond)
+	// после паники Parallel больше не берет элементы
+	select {
+	case perr := <-done:
+		if perr == nil || perr.Item != 1 {
+			t.Errorf("expected panic on item 1, got %v", perr)
+		}
+	case in <- 2:
+		t.Errorf("item taken after the panic")
+	case <-time.After(time.Second):
+		t.Fatal("job didn't stop")
+	}
+
+	// PanicSkip запускает Parallel снова для остальных элементов
+	source := job(func(in, out chan interface{}) {
+		for i := 0; i < 5; i++ {
+			out <- i
+		}
+	})
+	var collected []interface{}
+	collect := job(func(in, out chan interface{}) {
+		for item := range in {
+			collected = append(collected, item)
+		}
+	})
+	err := (&Pipeline{OnPanic: PanicSkip}).Execute(source, Parallel(func(item interface{}) (interface{}, error) {
+		if item == 1 {
+			panic("boom")
+		}
+		return item, nil
+	}, nil), collect)
+	if err != nil || len(collected) != 4 {
+		t.Errorf("bad item not skipped: %v, collected %v", err, collected)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withFastSigners подменяет функции расчета на такие же, но без задержек
+func withFastSigners(tb testing.TB) {
+	origMd5, origCrc32 := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data+DataSignerSalt)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+DataSignerSalt))), 10)
+	}
+	tb.Cleanup(func() {
+		DataSignerMd5, DataSignerCrc32 = origMd5, origCrc32
+	})
+}
+
+func signerJobs(n int, result *string) []job {
+	return []job{
+		job(func(in, out chan interface{}) {
+			for i := 0; i < n; i++ {
+				out <- i
+			}
+		}),
+		job(SingleHash),
+		job(MultiHash),
+		job(CombineResults),
+		job(func(in, out chan interface{}) {
+			for dataRaw := range in {
+				*result = dataRaw.(string)
+			}
+		}),
+	}
+}
+
+func TestPipelineBuffers(t *testing.T) {
+	withFastSigners(t)
+
+	var expected, got string
+	ExecutePipeline(signerJobs(20, &expected)...)
+
+	p := &Pipeline{Buffers: []int{4, 4, 4, 1}}
+	p.Execute(signerJobs(20, &got)...)
+	if got != expected {
+		t.Errorf("buffered pipeline result differs\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestPipelineDrop(t *testing.T) {
+	p := &Pipeline{Buffers: []int{1}, Overflow: OverflowDrop}
+
+	// счетчик не копится между запусками
+	for run := 0; run < 2; run++ {
+		var recieved int
+		p.Execute(
+			job(func(in, out chan interface{}) {
+				for i := 0; i < 100; i++ {
+					out <- i
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				for range in {
+					recieved++
+				}
+			}),
+		)
+
+		if recieved+int(p.Dropped()) != 100 {
+			t.Errorf("items lost in run %d\nGot: %d recieved + %d dropped\nExpected: 100", run, recieved, p.Dropped())
+		}
+	}
+}
+
+func TestPipelineUnbuffered(t *testing.T) {
+	var sent int32
+	(&Pipeline{}).Execute(
+		job(func(in, out chan interface{}) {
+			out <- 1
+			atomic.StoreInt32(&sent, 1)
+		}),
+		job(func(in, out chan interface{}) {
+			// без буфера отправка ждет, пока следующая стадия не возьмет значение
+			time.Sleep(10 * time.Millisecond)
+			if atomic.LoadInt32(&sent) != 0 {
+				t.Errorf("item sent before it was recieved")
+			}
+			for range in {
+			}
+		}),
+	)
+}
+
+// go test -bench Pipeline -benchmem
+func BenchmarkPipeline(b *testing.B) {
+	withFastSigners(b)
+
+	settings := []struct {
+		name     string
+		buffers  []int
+		overflow OverflowPolicy
+	}{
+		{"unbuffered", nil, OverflowBlock},
+		{"buffered-8", []int{8, 8, 8, 8}, OverflowBlock},
+		{"buffered-100", []int{100, 100, 100, 100}, OverflowBlock},
+		{"drop-8", []int{8, 8, 8, 8}, OverflowDrop},
+	}
+	for _, s := range settings {
+		b.Run(s.name, func(b *testing.B) {
+			var result string
+			for i := 0; i < b.N; i++ {
+				p := &Pipeline{Buffers: s.buffers, Overflow: s.overflow}
+				p.Execute(signerJobs(MaxInputDataLen, &result)...)
+				b.ReportMetric(float64(p.Dropped()), "dropped/op")
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import "sync"
+
+// Prioritized is an item with a priority, higher goes first.
+// Plain items have priority 0. SingleHash and MultiHash keep the priority
+// on their results, CombineResults drops it.
+type Prioritized struct {
+	Item     interface{}
+	Priority int
+}
+
+// withPriority runs fn on the item unwrapped from Prioritized
+// and wraps the result back with the same priority.
+func withPriority(item interface{}, fn func(item interface{}, priority int) (interface{}, error)) (interface{}, error) {
+	p, ok := item.(Prioritized)
+	if !ok {
+		return fn(item, 0)
+	}
+	res, err := fn(p.Item, p.Priority)
+	if err != nil {
+		return nil, err
+	}
+	return Prioritized{Item: res, Priority: p.Priority}, nil
+}
+
+func unwrapPriority(item interface{}) interface{} {
+	if p, ok := item.(Prioritized); ok {
+		return p.Item
+	}
+	return item
+}
+
+// PriorityLimiter lets one caller at a time in. Waiting callers are let in by
+// priority, in arrival order within the same priority, except that the longest
+// waiting one goes first after MaxBypass others were let in ahead of it,
+// so low priority callers are never starved.
+type PriorityLimiter struct {
+	MaxBypass int
+
+	mu       sync.Mutex
+	busy     bool
+	waiters  []*limiterWaiter // in arrival order
+	bypassed int
+}
+
+type limiterWaiter struct {
+	priority int
+	ready    chan struct{}
+}
+
+func (l *PriorityLimiter) Acquire(priority int) {
+	l.mu.Lock()
+	if !l.busy {
+		l.busy = true
+		l.mu.Unlock()
+		return
+	}
+	w := &limiterWaiter{priority: priority, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+	<-w.ready
+}
+
+func (l *PriorityLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) == 0 {
+		l.busy = false
+		return
+	}
+	next := 0
+	if l.bypassed < l.MaxBypass {
+		for i, w := range l.waiters {
+			if w.priority > l.waiters[next].priority {
+				next = i
+			}
+		}
+	}
+	if next == 0 {
+		l.bypassed = 0
+	} else {
+		l.bypassed++
+	}
+	w := l.waiters[next]
+	l.waiters = append(l.waiters[:next], l.waiters[next+1:]...)
+	close(w.ready)
+}
+
+// Waiting returns the number of callers blocked in Acquire.
+func (l *PriorityLimiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
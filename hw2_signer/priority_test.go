@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityLimiter(t *testing.T) {
+	l := &PriorityLimiter{MaxBypass: 2}
+	l.Acquire(0)
+
+	mu := &sync.Mutex{}
+	var order []string
+	wg := &sync.WaitGroup{}
+	waiters := []struct {
+		name     string
+		priority int
+	}{{"low1", 0}, {"low2", 0}, {"high1", 5}, {"high2", 5}, {"high3", 9}}
+	for i, w := range waiters {
+		wg.Add(1)
+		go func(name string, priority int) {
+			defer wg.Done()
+			l.Acquire(priority)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			l.Release()
+		}(w.name, w.priority)
+		// ждем, пока встанет в очередь, чтобы порядок прихода был известен
+		for l.Waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	l.Release()
+	wg.Wait()
+
+	// после двух обгонов пропускается самый долго ждущий
+	expected := []string{"high3", "high1", "low1", "high2", "low2"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("wrong order\nGot: %v\nExpected: %v", order, expected)
+	}
+}
+
+func TestPrioritizedItems(t *testing.T) {
+	withFastSigners(t)
+
+	plain, _ := SingleHashItem(3)
+	res, err := SingleHashItem(Prioritized{Item: 3, Priority: 7})
+	if err != nil || res != (Prioritized{Item: plain, Priority: 7}) {
+		t.Errorf("priority not kept\nGot: %v (%v)\nExpected: %v", res, err, Prioritized{Item: plain, Priority: 7})
+	}
+	if res, _ := DefaultScheme.MultiItem(Prioritized{Item: "x", Priority: 1}); res.(Prioritized).Priority != 1 {
+		t.Errorf("priority not kept by scheme: %v", res)
+	}
+
+	var expected, result string
+	ExecutePipeline(signerJobs(6, &expected)...)
+	jobs := signerJobs(6, &result)
+	jobs[0] = job(func(in, out chan interface{}) {
+		for i := 0; i < 6; i++ {
+			out <- Prioritized{Item: i, Priority: i % 2}
+		}
+	})
+	ExecutePipeline(jobs...)
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestPrioritizedStages(t *testing.T) {
+	withFastSigners(t)
+
+	plain, _ := MultiHashItem("x")
+	item := Prioritized{Item: "x", Priority: 3}
+	expected := Prioritized{Item: plain, Priority: 3}
+
+	cp, err := OpenCheckpoint(filepath.Join(t.TempDir(), "run.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	fn := cp.Item("multi", MultiHashItem)
+	// второй раз результат берется из лога, приоритет тот же
+	for i := 0; i < 2; i++ {
+		if res, err := fn(item); err != nil || res != expected {
+			t.Errorf("checkpointed\nGot: %v (%v)\nExpected: %v", res, err, expected)
+		}
+	}
+	if res, err := fn("x"); err != nil || res != plain {
+		t.Errorf("checkpointed plain\nGot: %v (%v)\nExpected: %v", res, err, plain)
+	}
+	if cp.Len() != 1 {
+		t.Errorf("priority recorded as a different item: %d records", cp.Len())
+	}
+
+	rs, err := DialStage(startWorkers(t, 1, MultiHashItem)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if res, err := rs.Item(item); err != nil || res != expected {
+		t.Errorf("remote\nGot: %v (%v)\nExpected: %v", res, err, expected)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StageProgress struct {
+	In       int  `json:"in"`
+	Out      int  `json:"out"`
+	Finished bool `json:"finished"`
+}
+
+type ProgressSnapshot struct {
+	Elapsed time.Duration
+	// ETA is -1 while it can't be estimated
+	ETA    time.Duration
+	Done   int
+	Total  int
+	Stages []StageProgress
+}
+
+func (s ProgressSnapshot) MarshalJSON() ([]byte, error) {
+	var eta *float64
+	if s.ETA >= 0 {
+		seconds := s.ETA.Seconds()
+		eta = &seconds
+	}
+	return json.Marshal(struct {
+		Elapsed float64         `json:"elapsed_seconds"`
+		ETA     *float64        `json:"eta_seconds"`
+		Done    int             `json:"done"`
+		Total   int             `json:"total"`
+		Stages  []StageProgress `json:"stages"`
+	}{s.Elapsed.Seconds(), eta, s.Done, s.Total, s.Stages})
+}
+
+// Progress is an Observer that counts items entering and leaving every stage
+// and estimates the time left from the rate of items leaving the tracked stage.
+// Time is taken from SignerClock.
+// Unless the total is given, it is the number of items sent by the first stage
+// once that stage has finished, and until then there is no estimate.
+type Progress struct {
+	mu     sync.Mutex
+	track  int
+	total  int // 0 if unknown
+	start  time.Time
+	stages []StageProgress
+}
+
+// NewProgress tracks items leaving stage track out of total, total 0 means unknown.
+func NewProgress(track, total int) *Progress {
+	return &Progress{track: track, total: total, start: SignerClock.Now()}
+}
+
+func (p *Progress) stage(i int) *StageProgress {
+	for len(p.stages) <= i {
+		p.stages = append(p.stages, StageProgress{})
+	}
+	return &p.stages[i]
+}
+
+func (p *Progress) StageStart(stage int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage(stage)
+}
+
+func (p *Progress) ItemIn(stage int, item interface{}, queueDepth int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage(stage).In++
+}
+
+func (p *Progress) ItemOut(stage int, item interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage(stage).Out++
+}
+
+func (p *Progress) StageDone(stage int, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage(stage).Finished = true
+}
+
+func (p *Progress) Snapshot() ProgressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := ProgressSnapshot{
+		Elapsed: SignerClock.Now().Sub(p.start),
+		ETA:     -1,
+		Total:   p.total,
+		Stages:  append([]StageProgress(nil), p.stages...),
+	}
+	if s.Total == 0 && len(p.stages) > 0 && p.stages[0].Finished {
+		s.Total = p.stages[0].Out
+	}
+	if p.track < len(p.stages) {
+		s.Done = p.stages[p.track].Out
+	}
+	if s.Total > 0 && s.Done > 0 {
+		left := s.Total - s.Done
+		if left < 0 {
+			left = 0
+		}
+		s.ETA = time.Duration(int64(s.Elapsed) * int64(left) / int64(s.Done))
+	}
+	return s
+}
+
+// Report writes the progress to w every interval until stop is called, and once more on stop.
+// On a terminal it draws a progress bar in place, otherwise it writes JSON lines.
+func (p *Progress) Report(w io.Writer, interval time.Duration) (stop func()) {
+	tty := isTerminal(w)
+	write := func() {
+		s := p.Snapshot()
+		if tty {
+			fmt.Fprint(w, "\r"+s.bar(30))
+			return
+		}
+		line, _ := json.Marshal(s)
+		fmt.Fprintf(w, "%s\n", line)
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		timer := SignerClock.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-done:
+				write()
+				if tty {
+					fmt.Fprintln(w)
+				}
+				return
+			case <-timer.C():
+				write()
+				timer.Reset(interval)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func (s ProgressSnapshot) bar(width int) string {
+	filled := 0
+	total := "?"
+	if s.Total > 0 {
+		filled = width * s.Done / s.Total
+		if filled > width {
+			filled = width
+		}
+		total = fmt.Sprint(s.Total)
+	}
+	eta := "?"
+	if s.ETA >= 0 {
+		eta = s.ETA.Round(time.Second).String()
+	}
+	stages := make([]string, len(s.Stages))
+	for i, st := range s.Stages {
+		stages[i] = fmt.Sprintf("%d/%d", st.In, st.Out)
+	}
+	return fmt.Sprintf("[%s%s] %d/%s  in/out %s  elapsed %s  eta %s ",
+		strings.Repeat("#", filled), strings.Repeat(" ", width-filled),
+		s.Done, total, strings.Join(stages, " "), s.Elapsed.Round(time.Second), eta)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	withFastSigners(t)
+
+	pr := NewProgress(2, 0)
+	var result string
+	(&Pipeline{Observer: pr}).Execute(signerJobs(5, &result)...)
+
+	s := pr.Snapshot()
+	if s.Done != 5 || s.Total != 5 || s.ETA != 0 {
+		t.Errorf("wrong progress\nGot: done %d total %d eta %s\nExpected: done 5 total 5 eta 0s", s.Done, s.Total, s.ETA)
+	}
+	for i, st := range s.Stages {
+		if !st.Finished {
+			t.Errorf("stage %d not finished", i)
+		}
+	}
+	if s.Stages[1].In != 5 || s.Stages[3].Out != 1 {
+		t.Errorf("wrong stage counts: %+v", s.Stages)
+	}
+
+	// пока неизвестно, сколько всего элементов, оценки нет
+	pr = NewProgress(1, 0)
+	pr.ItemOut(0, 1)
+	pr.ItemOut(1, 1)
+	if s := pr.Snapshot(); s.ETA != -1 {
+		t.Errorf("ETA without total: %s", s.ETA)
+	}
+	clock := NewFakeClock(time.Time{})
+	defer func(c Clock) { SignerClock = c }(SignerClock)
+	SignerClock = clock
+	pr = NewProgress(1, 4)
+	clock.Advance(time.Second)
+	pr.ItemOut(1, 1)
+	if s := pr.Snapshot(); s.Elapsed != time.Second || s.ETA != 3*time.Second {
+		t.Errorf("wrong ETA\nGot: elapsed %s eta %s\nExpected: elapsed 1s eta 3s", s.Elapsed, s.ETA)
+	}
+	if bar := pr.Snapshot().bar(8); !strings.HasPrefix(bar, "[##      ] 1/4") {
+		t.Errorf("wrong bar: %q", bar)
+	}
+}
+
+func TestProgressReport(t *testing.T) {
+	pr := NewProgress(0, 0)
+	buf := new(bytes.Buffer)
+	stop := pr.Report(buf, time.Hour)
+	pr.ItemOut(0, 1)
+	pr.StageDone(0, 0)
+	stop()
+
+	// buf не терминал, так что пишутся JSON строки
+	var line struct {
+		ETA    *float64 `json:"eta_seconds"`
+		Done   int      `json:"done"`
+		Total  int      `json:"total"`
+		Stages []StageProgress
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("not a JSON line: %q (%v)", buf.String(), err)
+	}
+	if line.Done != 1 || line.Total != 1 || line.ETA == nil || len(line.Stages) != 1 {
+		t.Errorf("wrong progress line: %s", buf.String())
+	}
+}
+
+func TestProgressReportInterval(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		clock := withFakeClock(t)
+		pr := NewProgress(0, 10)
+		buf := new(bytes.Buffer)
+		stop := pr.Report(buf, time.Second)
+		for i := 0; i < 5; i++ {
+			pr.ItemOut(0, i)
+			SignerClock.Sleep(time.Second)
+		}
+		SignerClock.Sleep(500 * time.Millisecond)
+		stop()
+
+		// строка каждую секунду симулированного времени и последняя при остановке
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		expected := `{"elapsed_seconds":5.5,"eta_seconds":5.5,"done":5,"total":10,"stages":[{"in":0,"out":5,"finished":false}]}`
+		if len(lines) != 6 || lines[5] != expected || clock.Now() != time.Date(2017, 1, 1, 0, 0, 5, 5e8, time.UTC) {
+			t.Errorf("wrong report at %s\nGot:\n%v\nExpected 6 lines, the last\n%v", clock.Now(), buf.String(), expected)
+		}
+	})
+}
+
+func TestCLIProgress(t *testing.T) {
+	withFastSigners(t)
+
+	buf := new(bytes.Buffer)
+	defer func(w io.Writer) { progressOut = w }(progressOut)
+	progressOut = buf
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"-progress", "1h", "-chain", "single"}, strings.NewReader("0\n1\n"), out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"done":2,"total":2`) {
+		t.Errorf("no final progress line: %q", buf.String())
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Remote stages exchange frames over a stream connection:
+//
+//	length uint32 | id uint64 | kind byte | payload
+//
+// length covers everything after itself, integers are big endian.
+// A worker answers every request frame with a frame of the same id,
+// answers may come in any order.
+const (
+	frameInt      = 'i' // payload is a decimal int
+	frameString   = 's'
+	framePriority = 'p' // payload is a decimal priority, a space and the kind and payload of the Prioritized item
+	frameError    = 'e' // payload is the error message, only sent by workers
+
+	frameHeaderLen = 8 + 1
+	maxFrameLen    = 16 << 20
+)
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+type frame struct {
+	id   uint64
+	kind byte
+	data []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	buf := make([]byte, 4+frameHeaderLen+len(f.data))
+	binary.BigEndian.PutUint32(buf, uint32(frameHeaderLen+len(f.data)))
+	binary.BigEndian.PutUint64(buf[4:], f.id)
+	buf[12] = f.kind
+	copy(buf[13:], f.data)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n < frameHeaderLen || n > maxFrameLen {
+		return frame{}, ErrFrameTooLarge
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frame{}, err
+	}
+	return frame{
+		id:   binary.BigEndian.Uint64(buf),
+		kind: buf[8],
+		data: buf[frameHeaderLen:],
+	}, nil
+}
+
+func encodeItem(id uint64, item interface{}) (frame, error) {
+	switch v := item.(type) {
+	case int:
+		return frame{id, frameInt, []byte(strconv.Itoa(v))}, nil
+	case string:
+		return frame{id, frameString, []byte(v)}, nil
+	case Prioritized:
+		inner, err := encodeItem(id, v.Item)
+		if err != nil || inner.kind == framePriority {
+			return frame{}, fmt.Errorf("cannot send Prioritized %T to remote stage", v.Item)
+		}
+		data := append([]byte(strconv.Itoa(v.Priority)+" "+string(inner.kind)), inner.data...)
+		return frame{id, framePriority, data}, nil
+	}
+	return frame{}, fmt.Errorf("cannot send %T to remote stage", item)
+}
+
+func decodeItem(f frame) (interface{}, error) {
+	switch f.kind {
+	case frameInt:
+		return strconv.Atoi(string(f.data))
+	case frameString:
+		return string(f.data), nil
+	case framePriority:
+		priority, rest, ok := strings.Cut(string(f.data), " ")
+		n, err := strconv.Atoi(priority)
+		if !ok || err != nil || rest == "" || rest[0] != frameInt && rest[0] != frameString {
+			return nil, errors.New("bad prioritized frame")
+		}
+		item, err := decodeItem(frame{f.id, rest[0], []byte(rest[1:])})
+		if err != nil {
+			return nil, err
+		}
+		return Prioritized{Item: item, Priority: n}, nil
+	case frameError:
+		return nil, errors.New(string(f.data))
+	}
+	return nil, fmt.Errorf("unknown frame kind %q", f.kind)
+}
+
+// ParseAddr splits "unix:/path/to/sock" or "tcp:host:port" into network and address.
+// Addresses without a known prefix are tcp.
+func ParseAddr(addr string) (network, address string) {
+	for _, network := range []string{"tcp", "unix"} {
+		if strings.HasPrefix(addr, network+":") {
+			return network, addr[len(network)+1:]
+		}
+	}
+	return "tcp", addr
+}
+
+// ServeStage runs fn for every item received on connections accepted from l,
+// until l is closed. Items of one connection are processed concurrently.
+func ServeStage(l net.Listener, fn ItemFunc) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveConn(conn, fn)
+	}
+}
+
+func serveConn(conn net.Conn, fn ItemFunc) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	wmu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		req, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				Logger.Error("remote stage: bad request", "remote", conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func(req frame) {
+			defer wg.Done()
+			resp, err := handleFrame(req, fn)
+			if err != nil {
+				resp = frame{req.id, frameError, []byte(err.Error())}
+			}
+			wmu.Lock()
+			defer wmu.Unlock()
+			if err := writeFrame(conn, resp); err != nil {
+				Logger.Error("remote stage: write failed", "remote", conn.RemoteAddr(), "err", err)
+			}
+		}(req)
+	}
+}
+
+func handleFrame(req frame, fn ItemFunc) (resp frame, err error) {
+	// a bad item must not take the whole worker down
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	item, err := decodeItem(req)
+	if err != nil {
+		return frame{}, err
+	}
+	res, err := fn(item)
+	if err != nil {
+		return frame{}, err
+	}
+	return encodeItem(req.id, res)
+}
+
+type remoteResult struct {
+	item interface{}
+	err  error
+}
+
+type remoteConn struct {
+	conn    net.Conn
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan remoteResult
+	err     error // set once the connection is broken
+}
+
+func (c *remoteConn) call(item interface{}) (interface{}, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	done := make(chan remoteResult, 1)
+	c.pending[id] = done
+	c.mu.Unlock()
+
+	req, err := encodeItem(id, item)
+	if err == nil {
+		c.wmu.Lock()
+		err = writeFrame(c.conn, req)
+		c.wmu.Unlock()
+	}
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	res := <-done
+	return res.item, res.err
+}
+
+func (c *remoteConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		resp, err := readFrame(r)
+		if err != nil {
+			c.fail(fmt.Errorf("remote stage %s: %w", c.conn.RemoteAddr(), err))
+			return
+		}
+		c.mu.Lock()
+		done, ok := c.pending[resp.id]
+		delete(c.pending, resp.id)
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		item, err := decodeItem(resp)
+		done <- remoteResult{item, err}
+	}
+}
+
+func (c *remoteConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	for id, done := range c.pending {
+		done <- remoteResult{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// RemoteStage sends items to worker processes running ServeStage,
+// spreading them round-robin over the connections.
+type RemoteStage struct {
+	conns []*remoteConn
+	mu    sync.Mutex
+	next  int
+}
+
+// DialStage connects to workers given as "unix:/path" or "tcp:host:port".
+func DialStage(addrs ...string) (*RemoteStage, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no worker addresses")
+	}
+	rs := &RemoteStage{}
+	for _, addr := range addrs {
+		network, address := ParseAddr(addr)
+		conn, err := net.Dial(network, address)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+		c := &remoteConn{conn: conn, pending: make(map[uint64]chan remoteResult)}
+		go c.readLoop()
+		rs.conns = append(rs.conns, c)
+	}
+	return rs, nil
+}
+
+// Item sends item to the next worker and waits for its answer.
+func (rs *RemoteStage) Item(item interface{}) (interface{}, error) {
+	rs.mu.Lock()
+	c := rs.conns[rs.next%len(rs.conns)]
+	rs.next++
+	rs.mu.Unlock()
+	return c.call(item)
+}
+
+// Job makes a job that processes every input item on the workers concurrently.
+func (rs *RemoteStage) Job(dead chan<- DeadLetter) job {
+	return Parallel(rs.Item, dead)
+}
+
+func (rs *RemoteStage) Close() error {
+	var err error
+	for _, c := range rs.conns {
+		if e := c.conn.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFrames(t *testing.T) {
+	buf := new(bytes.Buffer)
+	items := []interface{}{42, "4108050209~502633748", "", Prioritized{Item: "a b", Priority: -2}, Prioritized{Item: 7, Priority: 1}}
+	for i, item := range items {
+		f, err := encodeItem(uint64(i), item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFrame(buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, expected := range items {
+		f, err := readFrame(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := decodeItem(f)
+		if err != nil || f.id != uint64(i) || item != expected {
+			t.Errorf("frame %d: got %v (%v), expected %v", i, item, err, expected)
+		}
+	}
+
+	for _, item := range []interface{}{1.5, Prioritized{Item: Prioritized{Item: 1}}} {
+		if _, err := encodeItem(1, item); err == nil {
+			t.Errorf("expected error for %v", item)
+		}
+	}
+	for _, data := range []string{"", "1", "x i1", "1 e1", "1 p1 i1"} {
+		if _, err := decodeItem(frame{1, framePriority, []byte(data)}); err == nil {
+			t.Errorf("expected error for prioritized frame %q", data)
+		}
+	}
+}
+
+// startWorkers поднимает n локальных воркеров на unix-сокетах
+func startWorkers(t *testing.T, n int, fn ItemFunc) []string {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		path := filepath.Join(t.TempDir(), "worker"+strconv.Itoa(i)+".sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go ServeStage(l, fn)
+		addrs = append(addrs, "unix:"+path)
+	}
+	return addrs
+}
+
+func TestRemoteStage(t *testing.T) {
+	withFastSigners(t)
+
+	var expected, got string
+	ExecutePipeline(signerJobs(20, &expected)...)
+
+	rs, err := DialStage(startWorkers(t, 3, MultiHashItem)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	jobs := signerJobs(20, &got)
+	jobs[2] = rs.Job(nil)
+	ExecutePipeline(jobs...)
+
+	if got != expected {
+		t.Errorf("remote result differs\nGot: %v\nExpected: %v", got, expected)
+	}
+
+	// ошибки воркера приходят в dead letter
+	dead := make(chan DeadLetter, 1)
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- 1
+		}),
+		rs.Job(dead),
+	)
+	close(dead)
+	if d, ok := <-dead; !ok || d.Item != 1 || d.Err == nil {
+		t.Errorf("expected dead letter for int sent to MultiHash, got %+v", d)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// SignFunc is a signer that can fail, e.g. one backed by a remote service.
+type SignFunc func(data string) (string, error)
+
+var (
+	// SignerCrc32 and SignerMd5, if set, are used by SingleHash and MultiHash
+	// instead of DataSignerCrc32 and DataSignerMd5.
+	SignerCrc32 SignFunc
+	SignerMd5   SignFunc
+	// SignerRetry is applied to every signer call made by SingleHash and MultiHash.
+	SignerRetry = RetryPolicy{MaxAttempts: 1}
+)
+
+func crc32Sign(data string) (string, error) {
+	return sign("crc32", data, SignerCrc32, DataSignerCrc32)
+}
+
+func md5Sign(data string) (string, error) {
+	return sign("md5", data, SignerMd5, DataSignerMd5)
+}
+
+func sign(kind, data string, fallible SignFunc, infallible func(string) string) (string, error) {
+	fn := fallible
+	if fn == nil {
+		fn = func(data string) (string, error) {
+			return infallible(data), nil
+		}
+	}
+	fn = SignerRetry.Sign(fn)
+	if SignerCache == nil {
+		return fn(data)
+	}
+	return SignerCache.Get(kind, data, fn)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying for the default classifier.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func isTemporary(err error) bool {
+	var p permanentError
+	return !errors.As(err, &p)
+}
+
+// RetryPolicy retries failed calls with exponential backoff and full jitter:
+// before attempt n+1 it waits a random time in [0, min(MaxDelay, BaseDelay*2^(n-1))).
+type RetryPolicy struct {
+	// MaxAttempts counts the first call too, values < 1 mean one attempt
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay caps the backoff, 0 means no cap
+	MaxDelay time.Duration
+	// Retryable decides whether err is worth another attempt.
+	// nil retries everything except errors wrapped with Permanent.
+	Retryable func(err error) bool
+}
+
+func (p RetryPolicy) Do(fn func() error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = isTemporary
+	}
+
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.MaxAttempts || !retryable(err) {
+			break
+		}
+		SignerClock.Sleep(p.backoff(attempt))
+	}
+	if attempt > 1 {
+		return fmt.Errorf("after %d attempts: %w", attempt, err)
+	}
+	return err
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < math.MaxInt64/2; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+func (p RetryPolicy) Sign(fn SignFunc) SignFunc {
+	return func(data string) (res string, err error) {
+		err = p.Do(func() error {
+			res, err = fn(data)
+			return err
+		})
+		return res, err
+	}
+}
+
+func (p RetryPolicy) Item(fn ItemFunc) ItemFunc {
+	return func(item interface{}) (res interface{}, err error) {
+		err = p.Do(func() error {
+			res, err = fn(item)
+			return err
+		})
+		return res, err
+	}
+}
+
+// RetryStage makes a job that runs fn for every input item concurrently, retrying
+// failures according to policy. Items that still fail are sent to dead, see Parallel.
+func RetryStage(policy RetryPolicy, fn ItemFunc, dead chan<- DeadLetter) job {
+	return Parallel(policy.Item(fn), dead)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("signer unavailable")
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	calls := 0
+	err := policy.Do(func() error {
+		calls++
+		if calls < 3 {
+			return errUnavailable
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on 3rd attempt, got %d calls, err %v", calls, err)
+	}
+
+	calls = 0
+	err = policy.Do(func() error {
+		calls++
+		return errUnavailable
+	})
+	if !errors.Is(err, errUnavailable) || calls != 4 {
+		t.Errorf("expected 4 failed attempts, got %d calls, err %v", calls, err)
+	}
+
+	calls = 0
+	err = policy.Do(func() error {
+		calls++
+		return Permanent(errUnavailable)
+	})
+	if !errors.Is(err, errUnavailable) || calls != 1 {
+		t.Errorf("permanent error was retried, got %d calls, err %v", calls, err)
+	}
+}
+
+func TestRetryStageDeadLetter(t *testing.T) {
+	dead := make(chan DeadLetter, 10)
+	policy := RetryPolicy{MaxAttempts: 2}
+
+	var recieved []interface{}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 4; i++ {
+				out <- i
+			}
+		}),
+		RetryStage(policy, func(item interface{}) (interface{}, error) {
+			if item.(int)%2 == 1 {
+				return nil, errUnavailable
+			}
+			return item, nil
+		}, dead),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				recieved = append(recieved, val)
+			}
+		}),
+	)
+	close(dead)
+
+	if len(recieved) != 2 {
+		t.Errorf("wrong items passed: %v", recieved)
+	}
+	failed := 0
+	for d := range dead {
+		if !errors.Is(d.Err, errUnavailable) || d.Item.(int)%2 != 1 {
+			t.Errorf("unexpected dead letter: %+v", d)
+		}
+		failed++
+	}
+	if failed != 2 {
+		t.Errorf("wrong number of dead letters\nGot: %d\nExpected: 2", failed)
+	}
+}
+
+func TestSingleHashRetry(t *testing.T) {
+	withFastSigners(t)
+
+	var calls uint32
+	SignerCrc32 = func(data string) (string, error) {
+		// каждый второй вызов падает
+		if atomic.AddUint32(&calls, 1)%2 == 1 {
+			return "", errUnavailable
+		}
+		return DataSignerCrc32(data), nil
+	}
+	SignerRetry = RetryPolicy{MaxAttempts: 5}
+	defer func() {
+		SignerCrc32 = nil
+		SignerRetry = RetryPolicy{MaxAttempts: 1}
+	}()
+
+	res, err := SingleHashItem(0)
+	if err != nil || res != "4108050209~502633748" {
+		t.Errorf("wrong result\nGot: %v, %v\nExpected: %v", res, err, "4108050209~502633748")
+	}
+}
+
+func TestSignerFailureFailsPipeline(t *testing.T) {
+	withFastSigners(t)
+
+	SignerCrc32 = func(data string) (string, error) {
+		if data == "7" {
+			return "", errUnavailable
+		}
+		return DataSignerCrc32(data), nil
+	}
+	defer func() { SignerCrc32 = nil }()
+
+	// без dead letter упавший элемент не пропадает молча из подписи
+	var result string
+	err := (&Pipeline{}).Execute(signerJobs(10, &result)...)
+	var ierr *ItemError
+	if !errors.As(err, &ierr) || !errors.Is(err, errUnavailable) || ierr.Stage != 1 || ierr.Item != 7 {
+		t.Errorf("expected failure of item 7 in stage 1, got %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := run(nil, strings.NewReader("6\n7\n8\n"), out); !errors.Is(err, errUnavailable) {
+		t.Errorf("expected CLI error, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// hashFuncs are the signers a scheme can use, priority is the one of the signed item
+var hashFuncs = map[string]func(data string, priority int) (string, error){
+	"crc32": func(data string, _ int) (string, error) {
+		return crc32Sign(data)
+	},
+	"md5": func(data string, priority int) (string, error) {
+		md5Quota.Acquire(priority)
+		defer md5Quota.Release()
+		return md5Sign(data)
+	},
+}
+
+// hashExpr is a chain of signers applied to the input, like crc32(md5(d)).
+// The zero value is the input itself.
+type hashExpr struct {
+	fn  string
+	arg *hashExpr
+}
+
+func parseHashExpr(s string) (*hashExpr, error) {
+	s = strings.TrimSpace(s)
+	if s == "d" {
+		return &hashExpr{}, nil
+	}
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("bad expression %q, expected d or fn(expr)", s)
+	}
+	fn := strings.TrimSpace(s[:open])
+	if _, ok := hashFuncs[fn]; !ok {
+		return nil, fmt.Errorf("unknown hash function %q", fn)
+	}
+	arg, err := parseHashExpr(s[open+1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+	return &hashExpr{fn: fn, arg: arg}, nil
+}
+
+func (e *hashExpr) String() string {
+	if e.fn == "" {
+		return "d"
+	}
+	return e.fn + "(" + e.arg.String() + ")"
+}
+
+func (e *hashExpr) eval(data string, priority int) (string, error) {
+	if e.fn == "" {
+		return data, nil
+	}
+	arg, err := e.arg.eval(data, priority)
+	if err != nil {
+		return "", err
+	}
+	return hashFuncs[e.fn](arg, priority)
+}
+
+// Scheme is a signature recipe. DefaultScheme is the one of SingleHash, MultiHash and CombineResults.
+//
+// Schemes are written as semicolon or newline separated key=value pairs:
+//
+//	single  comma separated expressions over the input d, e.g. crc32(d),crc32(md5(d))
+//	sep     separator of the single parts
+//	rounds  number of multi rounds
+//	multi   expression applied to round+d in every round
+//	order   order of the combined results: sort, reverse or arrival
+//	join    separator of the combined results
+//
+// Missing keys keep their DefaultScheme values.
+type Scheme struct {
+	Single []*hashExpr
+	Sep    string
+	Rounds int
+	Multi  *hashExpr
+	Order  string
+	Join   string
+}
+
+const defaultSchemeSpec = "single=crc32(d),crc32(md5(d)); sep=~; rounds=6; multi=crc32(d); order=sort; join=_"
+
+var DefaultScheme = mustParseScheme("")
+
+func mustParseScheme(spec string) *Scheme {
+	s, err := ParseScheme(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func ParseScheme(spec string) (*Scheme, error) {
+	s := &Scheme{}
+	if err := s.parse(defaultSchemeSpec); err != nil {
+		return nil, err
+	}
+	if err := s.parse(spec); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Scheme) parse(spec string) error {
+	for _, pair := range strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("scheme: expected key=value, got %q", pair)
+		}
+		// separators may be spaces, so they are not trimmed
+		key = strings.TrimSpace(key)
+		if key != "sep" && key != "join" {
+			value = strings.TrimSpace(value)
+		}
+		if err := s.set(key, value); err != nil {
+			return fmt.Errorf("scheme: %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheme) set(key, value string) error {
+	switch key {
+	case "single":
+		s.Single = nil
+		for _, part := range strings.Split(value, ",") {
+			expr, err := parseHashExpr(part)
+			if err != nil {
+				return err
+			}
+			s.Single = append(s.Single, expr)
+		}
+	case "sep":
+		s.Sep = value
+	case "rounds":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("expected positive number, got %q", value)
+		}
+		s.Rounds = n
+	case "multi":
+		expr, err := parseHashExpr(value)
+		if err != nil {
+			return err
+		}
+		s.Multi = expr
+	case "order":
+		if value != "sort" && value != "reverse" && value != "arrival" {
+			return fmt.Errorf("expected sort, reverse or arrival, got %q", value)
+		}
+		s.Order = value
+	case "join":
+		s.Join = value
+	default:
+		return fmt.Errorf("unknown key")
+	}
+	return nil
+}
+
+func (s *Scheme) String() string {
+	single := make([]string, len(s.Single))
+	for i, e := range s.Single {
+		single[i] = e.String()
+	}
+	return fmt.Sprintf("single=%s;sep=%s;rounds=%d;multi=%s;order=%s;join=%s",
+		strings.Join(single, ","), s.Sep, s.Rounds, s.Multi, s.Order, s.Join)
+}
+
+type signResult struct {
+	res string
+	err error
+}
+
+// evalAll evaluates exprs concurrently, exprs[i] on data[i].
+func evalAll(exprs []*hashExpr, data []string, priority int) ([]string, error) {
+	wg := &sync.WaitGroup{}
+	res := make([]signResult, len(exprs))
+	for i := range exprs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := exprs[i].eval(data[i], priority)
+			res[i] = signResult{r, err}
+		}(i)
+	}
+	wg.Wait()
+
+	parts := make([]string, len(res))
+	for i, r := range res {
+		if r.err != nil {
+			return nil, r.err
+		}
+		parts[i] = r.res
+	}
+	return parts, nil
+}
+
+// SingleItem is SingleHashItem under the scheme.
+func (s *Scheme) SingleItem(dataRaw interface{}) (interface{}, error) {
+	return withPriority(dataRaw, s.single)
+}
+
+func (s *Scheme) single(dataRaw interface{}, priority int) (interface{}, error) {
+	var data string
+	switch v := dataRaw.(type) {
+	case string:
+		data = v
+	default:
+		data = strconv.Itoa(dataRaw.(int))
+	}
+	inputs := make([]string, len(s.Single))
+	for i := range inputs {
+		inputs[i] = data
+	}
+	parts, err := evalAll(s.Single, inputs, priority)
+	if err != nil {
+		return nil, err
+	}
+	Logger.Debug("single ready", "data", data, "parts", parts)
+	return strings.Join(parts, s.Sep), nil
+}
+
+// MultiItem is MultiHashItem under the scheme.
+func (s *Scheme) MultiItem(dataRaw interface{}) (interface{}, error) {
+	return withPriority(dataRaw, s.multi)
+}
+
+func (s *Scheme) multi(dataRaw interface{}, priority int) (interface{}, error) {
+	data, ok := dataRaw.(string)
+	if !ok {
+		panic("cannot convert input to string")
+	}
+	exprs := make([]*hashExpr, s.Rounds)
+	inputs := make([]string, s.Rounds)
+	for th := range inputs {
+		exprs[th] = s.Multi
+		inputs[th] = strconv.Itoa(th) + data
+	}
+	parts, err := evalAll(exprs, inputs, priority)
+	if err != nil {
+		return nil, err
+	}
+	res := strings.Join(parts, "")
+	Logger.Debug("multihash ready", "data", data, "result", res)
+	return res, nil
+}
+
+// Reduce is the CombineResults reducer under the scheme.
+func (s *Scheme) Reduce(items []string) string {
+	switch s.Order {
+	case "sort":
+		sort.Strings(items)
+	case "reverse":
+		sort.Sort(sort.Reverse(sort.StringSlice(items)))
+	}
+	return strings.Join(items, s.Join)
+}
+
+// Jobs returns the single, multi and combine stages of the scheme.
+func (s *Scheme) Jobs() (single, multi, combine job) {
+	return Parallel(s.SingleItem, nil), Parallel(s.MultiItem, nil), CombineWindowed(Window{}, s.Reduce)
+}
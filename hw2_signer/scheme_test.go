@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func runScheme(s *Scheme, n int) string {
+	var result string
+	single, multi, combine := s.Jobs()
+	jobs := signerJobs(n, &result)
+	jobs[1], jobs[2], jobs[3] = single, multi, combine
+	ExecutePipeline(jobs...)
+	return result
+}
+
+func TestScheme(t *testing.T) {
+	withFastSigners(t)
+
+	// значение из примера в hw2.md
+	if res, _ := DefaultScheme.SingleItem(0); res != "4108050209~502633748" {
+		t.Errorf("wrong default single hash\nGot: %v\nExpected: %v", res, "4108050209~502633748")
+	}
+
+	s, err := ParseScheme("single=md5(d); sep=-\nrounds=2; multi=crc32(md5(d)); order=reverse; join= | ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.String() != "single=md5(d);sep=-;rounds=2;multi=crc32(md5(d));order=reverse;join= | " {
+		t.Errorf("wrong parsed scheme: %s", s)
+	}
+
+	res := runScheme(s, 3)
+	parts := strings.Split(res, " | ")
+	if len(parts) != 3 || parts[0] < parts[1] || parts[1] < parts[2] {
+		t.Errorf("results not joined in reverse order: %v", res)
+	}
+
+	item, _ := s.MultiItem("x")
+	r0, _ := crc32Sign(DataSignerMd5("0x"))
+	r1, _ := crc32Sign(DataSignerMd5("1x"))
+	if item != r0+r1 {
+		t.Errorf("wrong multi result\nGot: %v\nExpected: %v", item, r0+r1)
+	}
+
+	for _, spec := range []string{"single=sha1(d)", "rounds=0", "order=random", "colour=red", "single=crc32(d", "multi"} {
+		if _, err := ParseScheme(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
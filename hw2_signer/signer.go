@@ -1,123 +1,216 @@
 package main
 
 import (
-	"fmt"
-	"runtime"
-	"sort"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ExecutePipeline runs jobs connected by channels. A panicking or failed stage stops
+// getting input, the error is logged.
 func ExecutePipeline(jobs ...job) {
-	wg := &sync.WaitGroup{}
-	prevChan := make(chan interface{})
-	defer close(prevChan)
-	for _, worker := range jobs {
-		wg.Add(1)
-		newChan := make(chan interface{})
-		go func(in, out chan interface{}, worker job, wg *sync.WaitGroup) {
-			defer wg.Done()
-			worker(in, out)
-			close(out)
-		}(prevChan, newChan, worker, wg)
-		prevChan = newChan
+	if err := (&Pipeline{}).Execute(jobs...); err != nil {
+		Logger.Error("pipeline failed", "err", err)
 	}
-	wg.Wait()
 }
 
-func SingleHash(in, out chan interface{}) {
-	wg := &sync.WaitGroup{}
-	quotaCh := make(chan struct{}, 1)
-	for dataRaw := range in {
-		data := strconv.Itoa(dataRaw.(int))
-		//fmt.Println("SingleHash. got - ", data)
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes a stage wait until the next one has room for the item
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop throws the item away if the next stage's buffer is full
+	OverflowDrop
+)
 
-		answ := make(chan string, 2)
+// Pipeline runs jobs like ExecutePipeline, with optional settings.
+type Pipeline struct {
+	// Observer, if set, receives events for every stage and every item passed between stages
+	Observer Observer
+	// Buffers[i] is the capacity of the channel between stage i and stage i+1, missing entries mean unbuffered
+	Buffers []int
+	// Overflow is applied when a stage sends to a full channel. With OverflowDrop and
+	// an unbuffered channel an item is only delivered if the next stage is already waiting for it.
+	Overflow OverflowPolicy
+	// OnPanic decides what happens when a stage panics
+	OnPanic PanicPolicy
+
+	dropped uint64
+	errMu   sync.Mutex
+	err     error
+}
 
-		go crc32Calc(answ, data)
-		go md5Calc(data, quotaCh, answ)
-		wg.Add(1)
-		go combine(answ, out, wg)
+// Dropped returns the number of items thrown away under OverflowDrop by the last Execute.
+func (p *Pipeline) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+func (p *Pipeline) buffer(stage int) int {
+	if stage < len(p.Buffers) {
+		return p.Buffers[stage]
 	}
-	wg.Wait()
+	return 0
 }
 
-func combine(answerCh chan string, outerCh chan interface{}, wg *sync.WaitGroup) {
-	defer wg.Done()
-	first := <-answerCh
-	second := <-answerCh
-	fmt.Println("combine. ready - ", first, "~", second)
-	outerCh <- first + "~" + second
+// stageInput remembers what was handed to a stage, to report it if the stage panics
+type stageInput struct {
+	mu   sync.Mutex
+	last interface{}
 }
-func crc32Calc(ch chan string, val string) {
-	res := DataSignerCrc32(val)
-	ch <- res
 
+func (s *stageInput) put(item interface{}) {
+	s.mu.Lock()
+	s.last = item
+	s.mu.Unlock()
 }
 
-func md5Calc(s string, quotaCh chan struct{}, ch chan string) {
-	quotaCh <- struct{}{}
-	resCh := make(chan string)
-	go func(s string, out chan string) {
-		v := DataSignerMd5(s)
-		out <- v
-	}(s, resCh)
-	res := <-resCh
-	<-quotaCh
-	go crc32Calc(ch, res)
+func (s *stageInput) get() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
 }
 
-func MultiHash(in, out chan interface{}) {
+// Execute runs jobs and waits for all of them. It returns a *PanicError
+// if a stage panicked under PanicFail, or the *ItemError of a failed Parallel job.
+//
+// Stages write straight to the channels of Buffers. Only with an Observer or OverflowDrop
+// a relay goroutine sits between two stages, holding one more item than the buffer.
+func (p *Pipeline) Execute(jobs ...job) error {
+	p.err = nil
+	atomic.StoreUint64(&p.dropped, 0)
+	relayed := p.Observer != nil || p.Overflow == OverflowDrop
 	wg := &sync.WaitGroup{}
-	runtime.GOMAXPROCS(1)
-	for dataRaw := range in {
-		data, ok := dataRaw.(string)
-		if !ok {
-			panic("cannot convert input to string")
+	inputs := make([]stageInput, len(jobs)+1)
+
+	// the first stage gets no input
+	prevChan := make(chan interface{})
+	close(prevChan)
+	for i, worker := range jobs {
+		next := make(chan interface{}, p.buffer(i))
+		if i == len(jobs)-1 {
+			// output of the last stage has no reader, it only gets counted
+			next = nil
+		}
+		out := next
+		if relayed || next == nil {
+			// the stage writes to its own channel, the relay moves items to the next one
+			out = make(chan interface{})
+			wg.Add(1)
+			go func(from, to chan interface{}, stage int) {
+				defer wg.Done()
+				p.relay(from, to, stage, &inputs[stage+1])
+			}(out, next, i)
 		}
 		wg.Add(1)
-		go thData(data, out, wg)
-		runtime.Gosched()
+		go func(in, out chan interface{}, worker job, stage int) {
+			defer wg.Done()
+			start := time.Now()
+			if p.Observer != nil {
+				p.Observer.StageStart(stage)
+			}
+			p.runStage(in, out, worker, stage, &inputs[stage])
+			close(out)
+			if p.Observer != nil {
+				p.Observer.StageDone(stage, time.Since(start))
+			}
+		}(prevChan, out, worker, i)
+		prevChan = next
 	}
 	wg.Wait()
+	return p.err
 }
 
-func thData(s string, out chan interface{}, wg *sync.WaitGroup) {
-	defer wg.Done()
+// runStage runs worker, recovering its panics according to OnPanic.
+// Under PanicSkip a Parallel worker is started again for the rest of the input.
+func (p *Pipeline) runStage(in, out chan interface{}, worker job, stage int, input *stageInput) {
+	for {
+		perr := catchPanic(func() { worker(in, out) })
+		if perr == nil {
+			return
+		}
+		if ierr, ok := perr.Value.(*ItemError); ok {
+			ierr.Stage = stage
+			p.fail(ierr)
+		} else {
+			perr.Stage = stage
+			if perr.Item == nil {
+				perr.Item = input.get()
+			}
+			if p.OnPanic == PanicSkip && perr.skippable {
+				Logger.Error("stage panicked, item skipped", "err", perr)
+				continue
+			}
+			p.fail(perr)
+		}
+		// let the previous stages finish
+		for range in {
+		}
+		return
+	}
+}
 
-	wgInner := &sync.WaitGroup{}
-	mu := &sync.Mutex{}
-	thS := make([]string, 6)
-	for i := 0; i <= 5; i++ {
-		wgInner.Add(1)
+func (p *Pipeline) fail(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	} else {
+		Logger.Error("pipeline failed again", "err", err)
+	}
+}
 
-		go func(i int, s string, wgInner *sync.WaitGroup, arr []string, mu *sync.Mutex) {
-			defer wgInner.Done()
-			res := DataSignerCrc32(strconv.Itoa(i) + s)
-			mu.Lock()
-			arr[i] = res
-			mu.Unlock()
-		}(i, s, wgInner, thS, mu)
+func (p *Pipeline) relay(from, to chan interface{}, stage int, next *stageInput) {
+	for item := range from {
+		if p.Observer != nil {
+			p.Observer.ItemOut(stage, item)
+		}
+		if to == nil {
+			continue
+		}
+		next.put(item)
+		if p.Overflow == OverflowDrop {
+			select {
+			case to <- item:
+			default:
+				atomic.AddUint64(&p.dropped, 1)
+				Logger.Debug("item dropped", "stage", stage)
+				continue
+			}
+		} else {
+			to <- item
+		}
+		if p.Observer != nil {
+			p.Observer.ItemIn(stage+1, item, len(to))
+		}
 	}
-	wgInner.Wait()
+	if to != nil {
+		close(to)
+	}
+}
 
-	res := strings.Join(thS, "")
-	fmt.Printf("result for %v is %v\n", s, res)
+// md5Quota serializes DataSignerMd5 calls, it overheats when called concurrently.
+// High priority items are signed first.
+var md5Quota = &PriorityLimiter{MaxBypass: 4}
 
-	out <- res
+func SingleHash(in, out chan interface{}) {
+	Parallel(SingleHashItem, nil)(in, out)
 }
 
-func CombineResults(in, out chan interface{}) {
-	var res []string
-	for dataRaw := range in {
-		data, ok := dataRaw.(string)
-		if !ok {
-			panic("cannot convert input to string")
-		}
-		res = append(res, data)
-	}
-	sort.Strings(res)
+// SingleHashItem computes crc32(data)~crc32(md5(data)) for one input number or string,
+// possibly Prioritized. It is the single stage of DefaultScheme.
+func SingleHashItem(dataRaw interface{}) (interface{}, error) {
+	return DefaultScheme.SingleItem(dataRaw)
+}
 
-	out <- strings.Join(res, "_")
+func MultiHash(in, out chan interface{}) {
+	Parallel(MultiHashItem, nil)(in, out)
+}
+
+// MultiHashItem concatenates crc32(th+data) for th = 0..5, the multi stage of DefaultScheme.
+func MultiHashItem(dataRaw interface{}) (interface{}, error) {
+	return DefaultScheme.MultiItem(dataRaw)
+}
+
+func CombineResults(in, out chan interface{}) {
+	CombineWindowed(Window{}, SortJoin)(in, out)
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ItemFunc processes one item of a stream. Jobs built from it with Parallel
+// handle every input item in its own goroutine.
+type ItemFunc func(item interface{}) (interface{}, error)
+
+// DeadLetter is an item that could not be processed.
+type DeadLetter struct {
+	Item interface{}
+	Err  error
+}
+
+// ItemError is the failure of an item in a Parallel job with no dead letter channel.
+type ItemError struct {
+	// Stage is the position of the job in the pipeline, -1 outside of a pipeline
+	Stage int
+	Item  interface{}
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("stage %d failed on item %v: %v", e.Stage, e.Item, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Parallel makes a job that runs fn for every input item concurrently.
+// Results are sent in the order they are ready. Failed items go to dead.
+//
+// After a panic of fn, or a failure if dead is nil, the job takes no more items:
+// once the ones already started are done, it panics with a *PanicError or an *ItemError
+// holding the first failed item. Pipeline.Execute returns an *ItemError as it is.
+// Running the job again after a panic goes on with the rest of the input.
+func Parallel(fn ItemFunc, dead chan<- DeadLetter) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		mu := &sync.Mutex{}
+		var panicked *PanicError
+		var failed *ItemError
+		stop := make(chan struct{})
+		stopOnce := &sync.Once{}
+	loop:
+		for {
+			var item interface{}
+			select {
+			case <-stop:
+				break loop
+			case next, ok := <-in:
+				if !ok {
+					break loop
+				}
+				item = next
+			}
+			wg.Add(1)
+			go func(item interface{}) {
+				defer wg.Done()
+				var res interface{}
+				var err error
+				perr := catchPanic(func() {
+					res, err = fn(item)
+				})
+				if perr != nil {
+					perr.Item = item
+					perr.skippable = true
+					mu.Lock()
+					if panicked == nil {
+						panicked = perr
+						stopOnce.Do(func() { close(stop) })
+					} else {
+						Logger.Error("item panicked", "err", perr)
+					}
+					mu.Unlock()
+					return
+				}
+				if err != nil && dead != nil {
+					dead <- DeadLetter{Item: item, Err: err}
+					return
+				}
+				if err != nil {
+					mu.Lock()
+					if failed == nil {
+						failed = &ItemError{Stage: -1, Item: item, Err: err}
+						stopOnce.Do(func() { close(stop) })
+					} else {
+						Logger.Error("item failed", "item", item, "err", err)
+					}
+					mu.Unlock()
+					return
+				}
+				out <- res
+			}(item)
+		}
+		wg.Wait()
+		if panicked != nil {
+			panic(panicked)
+		}
+		if failed != nil {
+			panic(failed)
+		}
+	}
+}
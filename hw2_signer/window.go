@@ -0,0 +1,98 @@
+package main
+
+import "time"
+
+// Reducer combines the items of one window into one result.
+type Reducer func(items []string) string
+
+// SortJoin is the CombineResults reducer: sorts the items and joins them with "_",
+// as DefaultScheme does.
+func SortJoin(items []string) string {
+	return DefaultScheme.Reduce(items)
+}
+
+// Window says when CombineWindowed emits a result. Any combination of fields can be set,
+// the window is closed by whichever fires first. Empty windows are not emitted.
+// The zero Window covers the whole stream, like CombineResults.
+type Window struct {
+	// Count closes the window after that many items
+	Count int
+	// Every closes the window periodically, windows are aligned to the stage start.
+	// Time is taken from SignerClock.
+	Every time.Duration
+	// Gap closes the window when no item came for that long (session window)
+	Gap time.Duration
+}
+
+// CombineWindowed makes a job that emits reduce(items) for every window of input strings.
+// Items left when the input is closed form the last window.
+func CombineWindowed(w Window, reduce Reducer) job {
+	return func(in, out chan interface{}) {
+		var items []string
+		flush := func() {
+			if len(items) == 0 {
+				return
+			}
+			out <- reduce(items)
+			items = nil
+		}
+
+		var tick Timer
+		var tickC <-chan time.Time
+		var next time.Time
+		if w.Every > 0 {
+			next = SignerClock.Now().Add(w.Every)
+			tick = SignerClock.NewTimer(w.Every)
+			defer tick.Stop()
+			tickC = tick.C()
+		}
+		var idle Timer
+		var idleC <-chan time.Time
+		if w.Gap > 0 {
+			idle = SignerClock.NewTimer(w.Gap)
+			idle.Stop()
+			defer idle.Stop()
+		}
+
+		for {
+			select {
+			case dataRaw, ok := <-in:
+				if !ok {
+					if w == (Window{}) {
+						// whole stream window is emitted even if empty
+						out <- reduce(items)
+						return
+					}
+					flush()
+					return
+				}
+				data, ok := unwrapPriority(dataRaw).(string)
+				if !ok {
+					panic("cannot convert input to string")
+				}
+				items = append(items, data)
+				if w.Count > 0 && len(items) >= w.Count {
+					flush()
+				}
+				if idle != nil {
+					// a gap that fired but was not handled yet must not close the new window
+					if !idle.Stop() {
+						select {
+						case <-idle.C():
+						default:
+						}
+					}
+					idle.Reset(w.Gap)
+					idleC = idle.C()
+				}
+			case <-tickC:
+				flush()
+				next = next.Add(w.Every)
+				tick.Reset(next.Sub(SignerClock.Now()))
+			case <-idleC:
+				idleC = nil
+				flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func runWindow(w Window, reduce Reducer, send func(out chan interface{})) []string {
+	var res []string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			send(out)
+		}),
+		CombineWindowed(w, reduce),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				res = append(res, val.(string))
+			}
+		}),
+	)
+	return res
+}
+
+func TestCombineWindowed(t *testing.T) {
+	send := func(items ...string) func(out chan interface{}) {
+		return func(out chan interface{}) {
+			for _, item := range items {
+				out <- item
+			}
+		}
+	}
+
+	res := runWindow(Window{}, SortJoin, send("c", "a", "b"))
+	if !reflect.DeepEqual(res, []string{"a_b_c"}) {
+		t.Errorf("whole stream window\nGot: %v\nExpected: [a_b_c]", res)
+	}
+
+	res = runWindow(Window{}, SortJoin, send())
+	if !reflect.DeepEqual(res, []string{""}) {
+		t.Errorf("empty whole stream must give one empty result\nGot: %q", res)
+	}
+
+	res = runWindow(Window{Count: 2}, SortJoin, send("b", "a", "d", "c", "e"))
+	if !reflect.DeepEqual(res, []string{"a_b", "c_d", "e"}) {
+		t.Errorf("count window\nGot: %v\nExpected: [a_b c_d e]", res)
+	}
+
+	concat := func(items []string) string { return strings.Join(items, "") }
+	synctest.Test(t, func(t *testing.T) {
+		withFakeClock(t)
+
+		res = runWindow(Window{Gap: 50 * time.Millisecond}, concat, func(out chan interface{}) {
+			out <- "a"
+			out <- "b"
+			SignerClock.Sleep(200 * time.Millisecond)
+			out <- "c"
+			SignerClock.Sleep(30 * time.Millisecond)
+			out <- "d"
+		})
+		if !reflect.DeepEqual(res, []string{"ab", "cd"}) {
+			t.Errorf("session window\nGot: %v\nExpected: [ab cd]", res)
+		}
+
+		res = runWindow(Window{Every: 100 * time.Millisecond}, concat, func(out chan interface{}) {
+			out <- "a"
+			SignerClock.Sleep(150 * time.Millisecond)
+			out <- "b"
+			SignerClock.Sleep(40 * time.Millisecond)
+			out <- "c"
+			SignerClock.Sleep(20 * time.Millisecond)
+			out <- "d"
+		})
+		// окна выровнены по старту стадии: [0, 100) [100, 200) [200, ...)
+		if !reflect.DeepEqual(res, []string{"a", "bc", "d"}) {
+			t.Errorf("time window\nGot: %v\nExpected: [a bc d]", res)
+		}
+	})
+}
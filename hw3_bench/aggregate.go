@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Aggregation groups the users matching Where by the values of the GroupBy fields
+// and counts them per group. A user with several values of a field, like several
+// browser families, is counted once in the group of every value. A user with none,
+// like one without browsers grouped by family, is counted in the group of the empty value.
+//
+// Browser family share by country:
+//
+//	Aggregation{GroupBy: []string{"country", "family"}}
+//
+// Companies with the most legacy IE users:
+//
+//	Aggregation{Where: MustParseQuery(`browser(family = "IE" and version ~ "^[5-9]\\.")`), GroupBy: []string{"company"}, Limit: 10}
+type Aggregation struct {
+	Where   Query    // nil for all users
+	GroupBy []string // no fields makes a single group of all users
+	// Distinct counts the different values of the field in every group,
+	// approximately if ApproxPrecision is set
+	Distinct string
+	// Top lists the TopN values of the field found for the most users in every group
+	Top  string
+	TopN int
+	// Limit keeps only the largest groups, 0 keeps all
+	Limit int
+}
+
+// Report is the result of an Aggregation, groups go from the largest.
+type Report struct {
+	GroupBy  []string `json:"group_by"`
+	Distinct string   `json:"distinct_field,omitempty"`
+	Top      string   `json:"top_field,omitempty"`
+	Groups   []Group  `json:"groups"`
+}
+
+type Group struct {
+	Key   []string `json:"key"`
+	Count int      `json:"count"`
+	// Share is Count out of the total Count of the groups whose keys differ only in the last field
+	Share    float64    `json:"share"`
+	Distinct int        `json:"distinct,omitempty"`
+	Top      []TopValue `json:"top,omitempty"`
+}
+
+type TopValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type groupState struct {
+	key      []string
+	count    int
+	distinct distinctCounter
+	top      map[string]int
+}
+
+// eachValue calls fn for every value of the field of u, the userFields iterate
+// over all values as long as the match returns false.
+func eachValue(field string, u *User, fn func(string)) {
+	userFields[field](u, func(s string) bool {
+		fn(s)
+		return false
+	})
+}
+
+// userValues returns the distinct values of the field of u
+func userValues(field string, u *User) []string {
+	var values []string
+	eachValue(field, u, func(s string) {
+		for _, v := range values {
+			if v == s {
+				return
+			}
+		}
+		values = append(values, s)
+	})
+	return values
+}
+
+func (a *Aggregation) check() error {
+	fields := append([]string{}, a.GroupBy...)
+	if a.Distinct != "" {
+		fields = append(fields, a.Distinct)
+	}
+	if a.Top != "" {
+		fields = append(fields, a.Top)
+	}
+	for _, f := range fields {
+		if _, ok := userFields[f]; !ok {
+			return fmt.Errorf("unknown field %q", f)
+		}
+	}
+	return nil
+}
+
+// Run aggregates the users read from r.
+func (a *Aggregation) Run(r io.Reader) (*Report, error) {
+	if err := a.check(); err != nil {
+		return nil, err
+	}
+	groups := map[string]*groupState{}
+	err := ScanUsers(r, a.Where, func(i int, u *User) {
+		var distinct, top []string
+		if a.Distinct != "" {
+			distinct = userValues(a.Distinct, u)
+		}
+		if a.Top != "" {
+			top = userValues(a.Top, u)
+		}
+		a.eachKey(u, 0, make([]string, len(a.GroupBy)), func(key []string) {
+			id := strings.Join(key, "\x00")
+			g, ok := groups[id]
+			if !ok {
+				g = &groupState{key: append([]string(nil), key...), distinct: newDistinctCounter(), top: map[string]int{}}
+				groups[id] = g
+			}
+			g.count++
+			for _, v := range distinct {
+				g.distinct.Add(v)
+			}
+			for _, v := range top {
+				g.top[v]++
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.report(groups), nil
+}
+
+// eachKey calls fn with every combination of the GroupBy values of u,
+// a field without values takes the empty one
+func (a *Aggregation) eachKey(u *User, i int, key []string, fn func(key []string)) {
+	if i == len(a.GroupBy) {
+		fn(key)
+		return
+	}
+	values := userValues(a.GroupBy[i], u)
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	for _, v := range values {
+		key[i] = v
+		a.eachKey(u, i+1, key, fn)
+	}
+}
+
+func (a *Aggregation) report(groups map[string]*groupState) *Report {
+	rep := &Report{GroupBy: a.GroupBy, Distinct: a.Distinct, Top: a.Top, Groups: make([]Group, 0, len(groups))}
+
+	parents := map[string]int{}
+	for _, g := range groups {
+		parents[parentKey(g.key)] += g.count
+	}
+	for _, g := range groups {
+		group := Group{Key: g.key, Count: g.count, Share: float64(g.count) / float64(parents[parentKey(g.key)])}
+		if a.Distinct != "" {
+			group.Distinct = g.distinct.Count()
+		}
+		if a.Top != "" {
+			group.Top = topValues(g.top, a.TopN)
+		}
+		rep.Groups = append(rep.Groups, group)
+	}
+
+	sort.Slice(rep.Groups, func(i, j int) bool {
+		gi, gj := rep.Groups[i], rep.Groups[j]
+		if gi.Count != gj.Count {
+			return gi.Count > gj.Count
+		}
+		return strings.Join(gi.Key, "\x00") < strings.Join(gj.Key, "\x00")
+	})
+	if a.Limit > 0 && len(rep.Groups) > a.Limit {
+		rep.Groups = rep.Groups[:a.Limit]
+	}
+	return rep
+}
+
+func parentKey(key []string) string {
+	if len(key) == 0 {
+		return ""
+	}
+	return strings.Join(key[:len(key)-1], "\x00")
+}
+
+func topValues(counts map[string]int, n int) []TopValue {
+	top := make([]TopValue, 0, len(counts))
+	for v, c := range counts {
+		top = append(top, TopValue{v, c})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Write writes the report as a table, csv or json, with Redactions applied.
+// Group keys can't be masked or dropped.
+func (rep *Report) Write(w io.Writer, format string) error {
+	rep, err := rep.redacted()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "table":
+		return rep.writeTable(w)
+	case "csv":
+		return rep.writeCSV(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func (rep *Report) header() []string {
+	header := append(append([]string{}, rep.GroupBy...), "count", "share")
+	if rep.Distinct != "" {
+		header = append(header, "distinct "+rep.Distinct)
+	}
+	if rep.Top != "" {
+		header = append(header, "top "+rep.Top)
+	}
+	return header
+}
+
+func (rep *Report) rows() [][]string {
+	rows := make([][]string, 0, len(rep.Groups))
+	for _, g := range rep.Groups {
+		row := append(append([]string{}, g.Key...), strconv.Itoa(g.Count), strconv.FormatFloat(g.Share*100, 'f', 1, 64)+"%")
+		if rep.Distinct != "" {
+			row = append(row, strconv.Itoa(g.Distinct))
+		}
+		if rep.Top != "" {
+			top := make([]string, len(g.Top))
+			for i, t := range g.Top {
+				top[i] = t.Value + " (" + strconv.Itoa(t.Count) + ")"
+			}
+			row = append(row, strings.Join(top, ", "))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (rep *Report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, row := range append([][]string{rep.header()}, rep.rows()...) {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (rep *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(rep.header())
+	cw.WriteAll(rep.rows())
+	return cw.Error()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	uaChrome  = "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/33.0.1750.154 Safari/537.36"
+	uaIE6     = "Mozilla/4.0 (compatible; MSIE 6.0; Windows NT 5.1)"
+	uaFirefox = "Mozilla/5.0 (X11; Linux x86_64; rv:49.0) Gecko/20100101 Firefox/49.0"
+
+	uaIE11     = "Mozilla/5.0 (Windows NT 6.3; Trident/7.0; rv:11.0) like Gecko"
+	uaFirefox5 = "Mozilla/5.0 (Windows NT 6.1; rv:5.0) Gecko/20100101 Firefox/5.0"
+)
+
+var aggregateUsers = strings.Join([]string{
+	`{"browsers":["` + uaChrome + `","` + uaIE6 + `"],"company":"Acme","country":"Peru","email":"a@acme.com"}`,
+	`{"browsers":["` + uaChrome + `"],"company":"Acme","country":"Peru","email":"b@acme.com"}`,
+	`{"browsers":["` + uaFirefox + `","` + uaChrome + `"],"company":"Initech","country":"Chile","email":"c@initech.com"}`,
+	`{"browsers":["` + uaIE6 + `"],"company":"Initech","country":"Peru","email":"d@initech.com"}`,
+}, "\n")
+
+func TestAggregation(t *testing.T) {
+	a := &Aggregation{GroupBy: []string{"country", "family"}, Distinct: "email", Top: "company", TopN: 1}
+	rep, err := a.Run(strings.NewReader(aggregateUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Group{
+		{Key: []string{"Peru", "Chrome"}, Count: 2, Share: 0.5, Distinct: 2, Top: []TopValue{{"Acme", 2}}},
+		{Key: []string{"Peru", "IE"}, Count: 2, Share: 0.5, Distinct: 2, Top: []TopValue{{"Acme", 1}}},
+		{Key: []string{"Chile", "Chrome"}, Count: 1, Share: 0.5, Distinct: 1, Top: []TopValue{{"Initech", 1}}},
+		{Key: []string{"Chile", "Firefox"}, Count: 1, Share: 0.5, Distinct: 1, Top: []TopValue{{"Initech", 1}}},
+	}
+	if !reflect.DeepEqual(rep.Groups, expected) {
+		t.Errorf("wrong groups\nGot: %+v\nExpected: %+v", rep.Groups, expected)
+	}
+
+	// компании с наибольшим числом пользователей старого IE
+	a = &Aggregation{Where: MustParseQuery(`browser(family = "IE" and version ~ "^[5-9]\\.")`), GroupBy: []string{"company"}, Limit: 1}
+	rep, err = a.Run(strings.NewReader(aggregateUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Groups) != 1 || rep.Groups[0].Key[0] != "Acme" || rep.Groups[0].Share != 0.5 {
+		t.Errorf("wrong legacy IE report: %+v", rep.Groups)
+	}
+	// IE11 и Firefox 5 - это не старый IE, хотя по отдельности условия выполняются
+	rep, err = a.Run(strings.NewReader(`{"browsers":["` + uaIE11 + `","` + uaFirefox5 + `"],"company":"Modern"}`))
+	if err != nil || len(rep.Groups) != 0 {
+		t.Errorf("legacy IE found in IE11 and Firefox 5 (%v): %+v", err, rep.Groups)
+	}
+
+	rep, err = (&Aggregation{}).Run(strings.NewReader(aggregateUsers))
+	if err != nil || len(rep.Groups) != 1 || rep.Groups[0].Count != 4 {
+		t.Errorf("expected one group of all users, got %+v (%v)", rep, err)
+	}
+
+	// пользователь без браузеров попадает в группу пустого значения
+	rep, err = (&Aggregation{GroupBy: []string{"family"}}).Run(strings.NewReader(`{"browsers":["` + uaIE6 + `"]}` + "\n{}\n{\"browsers\":[]}"))
+	expected = []Group{
+		{Key: []string{""}, Count: 2, Share: 2.0 / 3},
+		{Key: []string{"IE"}, Count: 1, Share: 1.0 / 3},
+	}
+	if err != nil || !reflect.DeepEqual(rep.Groups, expected) {
+		t.Errorf("users without values not counted (%v)\nGot: %+v\nExpected: %+v", err, rep.Groups, expected)
+	}
+
+	if _, err := (&Aggregation{GroupBy: []string{"salary"}}).Run(strings.NewReader(aggregateUsers)); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	rep, err := (&Aggregation{GroupBy: []string{"company"}, Top: "family", TopN: 2}).Run(strings.NewReader(aggregateUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := rep.Write(out, "table"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "" +
+		"company  count  share  top family\n" +
+		"Acme     2      50.0%  Chrome (2), IE (1)\n" +
+		"Initech  2      50.0%  Chrome (1), Firefox (1)\n"
+	if out.String() != expected {
+		t.Errorf("wrong table\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := rep.Write(out, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	expected = "company,count,share,top family\nAcme,2,50.0%,\"Chrome (2), IE (1)\"\nInitech,2,50.0%,\"Chrome (1), Firefox (1)\"\n"
+	if out.String() != expected {
+		t.Errorf("wrong csv\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := rep.Write(out, "json"); err != nil {
+		t.Fatal(err)
+	}
+	parsed := &Report{}
+	if err := json.Unmarshal(out.Bytes(), parsed); err != nil || !reflect.DeepEqual(parsed, rep) {
+		t.Errorf("wrong json (%v)\nGot: %+v\nExpected: %+v", err, parsed, rep)
+	}
+
+	if err := rep.Write(out, "xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestAggregateCLI(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := run([]string{"-group", "device", "-where", `country = "Peru"`, "-format", "csv", "-"}, strings.NewReader(aggregateUsers), out)
+	if err != nil || out.String() != "device,count,share\ndesktop,3,100.0%\n" {
+		t.Errorf("wrong CLI report (%v)\nGot:\n%v", err, out.String())
+	}
+	if err := run([]string{"-group", "country", "-format", "xml", "-"}, strings.NewReader(aggregateUsers), out); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+	if err := run([]string{"-where", "country", "-"}, strings.NewReader(aggregateUsers), out); err == nil {
+		t.Errorf("expected error for bad query")
+	}
+}
@@ -18,11 +18,19 @@ func SlowSearch(out io.Writer) {
 	if err != nil {
 		panic(err)
 	}
+	defer file.Close()
 
-	fileContents, err := ioutil.ReadAll(file)
-	if err != nil {
+	if err := SlowSearchFrom(out, file); err != nil {
 		panic(err)
 	}
+}
+
+// SlowSearchFrom is SlowSearch over users read from in.
+func SlowSearchFrom(out io.Writer, in io.Reader) error {
+	fileContents, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
 
 	r := regexp.MustCompile("@")
 	seenBrowsers := []string{}
@@ -37,7 +45,7 @@ func SlowSearch(out io.Writer) {
 		// fmt.Printf("%v %v\n", err, line)
 		err := json.Unmarshal([]byte(line), &user)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		users = append(users, user)
 	}
@@ -108,4 +116,5 @@ func SlowSearch(out io.Writer) {
 
 	fmt.Fprintln(out, "found users:\n"+foundUsers)
 	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	return nil
 }
@@ -71,10 +71,18 @@ func easyjsonC80ae7adDecodeHw3BenchModel(in *jlexer.Lexer, out *User) {
 				in.Delim(']')
 			}
 
+		case "company":
+			out.Company = in.String()
+		case "country":
+			out.Country = in.String()
 		case "email":
 			out.Email = in.String()
+		case "job":
+			out.Job = in.String()
 		case "name":
 			out.Name = in.String()
+		case "phone":
+			out.Phone = in.String()
 		default:
 			in.SkipRecursive()
 		}
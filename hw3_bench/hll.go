@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// ApproxPrecision switches distinct counts, like Total unique browsers and
+// Aggregation.Distinct, from exact sets to HyperLogLog with 2^ApproxPrecision registers.
+// 0 counts exactly.
+var ApproxPrecision uint8
+
+// distinctCounter counts different strings
+type distinctCounter interface {
+	Add(s string)
+	AddBytes(b []byte)
+	Count() int
+	// Merge adds the strings counted by other, a counter of the same kind
+	Merge(other distinctCounter)
+}
+
+func newDistinctCounter() distinctCounter {
+	if ApproxPrecision == 0 {
+		return exactSet{}
+	}
+	return NewHyperLogLog(ApproxPrecision)
+}
+
+// TL;DR map[]struct{} is 5% faster in time and 10% less memory consumption comparing to map[]bool when it comes to a big Set.
+// https://itnext.io/set-in-go-map-bool-and-map-struct-performance-comparison-5315b4b107b
+type exactSet map[string]struct{}
+
+func (s exactSet) Add(v string) {
+	s[v] = struct{}{}
+}
+
+func (s exactSet) AddBytes(b []byte) {
+	// the lookup doesn't allocate, only new values are copied
+	if _, ok := s[string(b)]; !ok {
+		s[string(b)] = struct{}{}
+	}
+}
+
+func (s exactSet) Count() int {
+	return len(s)
+}
+
+func (s exactSet) Merge(other distinctCounter) {
+	for v := range other.(exactSet) {
+		s[v] = struct{}{}
+	}
+}
+
+// HyperLogLog estimates the number of distinct strings added to it in 2^p one byte registers.
+// The relative standard error of Count is 1.04/sqrt(2^p), so it is within twice that
+// in 95% of cases:
+//
+//	p   memory  error  95%
+//	10  1 KB    3.3%   6.5%
+//	12  4 KB    1.6%   3.3%
+//	14  16 KB   0.8%   1.6%
+//	16  64 KB   0.4%   0.8%
+//
+// Below 2.5*2^p distinct values it switches to linear counting, which is nearly exact
+// while few registers are set. Counts are deterministic: the same strings give the same estimate.
+type HyperLogLog struct {
+	p         uint8
+	registers []uint8
+}
+
+// NewHyperLogLog makes a HyperLogLog of precision p, from 4 to 18.
+func NewHyperLogLog(p uint8) *HyperLogLog {
+	if p < 4 || p > 18 {
+		panic(fmt.Sprintf("HyperLogLog precision %d out of 4..18", p))
+	}
+	return &HyperLogLog{p: p, registers: make([]uint8, 1<<p)}
+}
+
+func (h *HyperLogLog) Add(s string) {
+	h.addHash(hashString(s))
+}
+
+func (h *HyperLogLog) AddBytes(b []byte) {
+	// string(b) as an argument of a non escaping call doesn't allocate
+	h.addHash(hashString(string(b)))
+}
+
+func (h *HyperLogLog) addHash(x uint64) {
+	i := x >> (64 - h.p)
+	// rank of the first 1 bit after the index bits, the sentinel caps it at 64-p+1
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *HyperLogLog) Count() int {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := hllAlpha(len(h.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
+
+func (h *HyperLogLog) Merge(other distinctCounter) {
+	o := other.(*HyperLogLog)
+	if o.p != h.p {
+		panic(fmt.Sprintf("merging HyperLogLog of precision %d into %d", o.p, h.p))
+	}
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func hllAlpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// hashString is 64 bit FNV-1a with the murmur3 finalizer, FNV alone mixes the high bits poorly
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
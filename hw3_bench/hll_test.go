@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withApprox включает HyperLogLog на время теста
+func withApprox(t *testing.T, p uint8) {
+	orig := ApproxPrecision
+	ApproxPrecision = p
+	t.Cleanup(func() { ApproxPrecision = orig })
+}
+
+// checkEstimate проверяет, что оценка не дальше трех стандартных ошибок от точного значения
+func checkEstimate(t *testing.T, name string, p uint8, got, exact int) {
+	t.Helper()
+	bound := 3 * 1.04 / math.Sqrt(float64(int(1)<<p))
+	if diff := math.Abs(float64(got-exact)) / float64(exact); diff > bound {
+		t.Errorf("%s, p=%d: error %.2f%% over %.2f%%\nGot: %v\nExpected: %v", name, p, diff*100, bound*100, got, exact)
+	}
+}
+
+func TestHyperLogLogUsers(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	exact := map[string]exactSet{"browsers": {}, "email": {}, "company": {}}
+	hlls := map[string]map[uint8]*HyperLogLog{}
+	for field := range exact {
+		hlls[field] = map[uint8]*HyperLogLog{}
+		for _, p := range []uint8{4, 10, 14} {
+			hlls[field][p] = NewHyperLogLog(p)
+		}
+	}
+	err = ScanUsers(file, nil, func(i int, u *User) {
+		for field, set := range exact {
+			eachValue(field, u, func(v string) {
+				set.Add(v)
+				for _, h := range hlls[field] {
+					h.Add(v)
+				}
+			})
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for field, set := range exact {
+		for p, h := range hlls[field] {
+			checkEstimate(t, field, p, h.Count(), set.Count())
+		}
+	}
+}
+
+func TestHyperLogLogLarge(t *testing.T) {
+	for _, p := range []uint8{10, 12, 16} {
+		h := NewHyperLogLog(p)
+		for _, n := range []int{1000, 50000, 300000} {
+			for i := 0; i < n; i++ {
+				h.Add("user" + strconv.Itoa(i))
+			}
+			checkEstimate(t, "synthetic", p, h.Count(), n)
+		}
+	}
+
+	// объединение равно подсчету по всем строкам сразу
+	a, b, all := NewHyperLogLog(12), NewHyperLogLog(12), NewHyperLogLog(12)
+	for i := 0; i < 20000; i++ {
+		s := strconv.Itoa(i)
+		all.AddBytes([]byte(s))
+		if i%3 == 0 {
+			a.Add(s)
+		} else {
+			b.Add(s)
+		}
+	}
+	a.Merge(b)
+	if a.Count() != all.Count() {
+		t.Errorf("merged count\nGot: %v\nExpected: %v", a.Count(), all.Count())
+	}
+}
+
+func TestApproxSearch(t *testing.T) {
+	exactOut := new(bytes.Buffer)
+	FastSearch(exactOut)
+
+	withApprox(t, 14)
+	approxOut := new(bytes.Buffer)
+	FastSearch(approxOut)
+
+	exactUsers, exactTotal := splitReport(t, exactOut.String())
+	approxUsers, approxTotal := splitReport(t, approxOut.String())
+	if approxUsers != exactUsers {
+		t.Errorf("found users differ in approximate mode")
+	}
+	checkEstimate(t, "unique browsers", 14, approxTotal, exactTotal)
+
+	// слияние HyperLogLog по кускам дает ту же оценку
+	for _, search := range []func(){
+		func() { FastSearchParallel(approxOut, 3) },
+		func() { FastSearchMmap(approxOut, 3) },
+		func() { FastSearchRaw(approxOut) },
+	} {
+		approxOut.Reset()
+		search()
+		if _, total := splitReport(t, approxOut.String()); total != approxTotal {
+			t.Errorf("estimate differs\nGot: %v\nExpected: %v", total, approxTotal)
+		}
+	}
+
+	rep, err := (&Aggregation{Distinct: "email"}).Run(strings.NewReader(aggregateUsers))
+	if err != nil || rep.Groups[0].Distinct != 4 {
+		t.Errorf("wrong approximate distinct: %+v (%v)", rep, err)
+	}
+
+	out := new(bytes.Buffer)
+	err = run([]string{"-approx", "10", "-distinct", "company", "-format", "csv", "-"}, strings.NewReader(aggregateUsers), out)
+	if err != nil || out.String() != "count,share,distinct company\n4,100.0%,2\n" {
+		t.Errorf("wrong CLI report (%v)\nGot:\n%v", err, out.String())
+	}
+	if err := run([]string{"-approx", "3"}, nil, out); err == nil {
+		t.Errorf("expected error for precision 3")
+	}
+	// SlowSearch считает только точно
+	if err := run([]string{"-slow", "-approx", "10"}, nil, out); err == nil {
+		t.Errorf("expected error for -slow -approx")
+	}
+}
+
+func splitReport(t *testing.T, report string) (string, int) {
+	i := strings.LastIndex(report, "Total unique browsers ")
+	total, err := strconv.Atoi(strings.TrimSpace(report[i+len("Total unique browsers "):]))
+	if i < 0 || err != nil {
+		t.Fatalf("bad report %q", report)
+	}
+	return report[:i], total
+}
+
+func TestNewHyperLogLogPrecision(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for precision 3")
+		}
+	}()
+	NewHyperLogLog(3)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// indexMagic starts index files, the last byte is the format version
+var indexMagic = []byte("USRIDX\x00\x01")
+
+// Index is a users file converted for repeated searches by browser substrings.
+// Users are rows numbered as the lines. Tokens are the runs of letters and digits
+// in browsers, so "Android" and "MSIE" are tokens of
+//
+//	Mozilla/5.0 (Linux; U; Android 4.0.3; MSIE 9.0)
+//
+// and the postings of the tokens containing the runs of a substring narrow down
+// the browsers to check for it.
+//
+// On disk, after indexMagic, everything is uvarints and strings prefixed by their length:
+//
+//	rows, names and emails of all rows
+//	browsers, each different browser once
+//	browser ids of every row
+//	tokens, each with the ids of its browsers and its rows, both ascending and delta coded
+type Index struct {
+	names, emails []string
+	browsers      []string
+	rowBrowsers   [][]uint32
+	tokens        map[string]*posting
+}
+
+// posting lists the browsers and rows containing a token
+type posting struct {
+	browsers, rows []uint32
+}
+
+// NewIndex indexes the users read from r.
+func NewIndex(r io.Reader) (*Index, error) {
+	ix := &Index{tokens: map[string]*posting{}}
+	browserIDs := map[string]uint32{}
+	err := ScanUsers(r, nil, func(i int, u *User) {
+		row := uint32(i)
+		ix.names = append(ix.names, u.Name)
+		ix.emails = append(ix.emails, u.Email)
+		ids := make([]uint32, 0, len(u.Browsers))
+		for _, browser := range u.Browsers {
+			id, ok := browserIDs[browser]
+			if !ok {
+				id = uint32(len(ix.browsers))
+				browserIDs[browser] = id
+				ix.browsers = append(ix.browsers, browser)
+				for _, token := range browserTokens(browser) {
+					p := ix.posting(token)
+					if n := len(p.browsers); n == 0 || p.browsers[n-1] != id {
+						p.browsers = append(p.browsers, id)
+					}
+				}
+			}
+			ids = append(ids, id)
+			for _, token := range browserTokens(browser) {
+				p := ix.posting(token)
+				if n := len(p.rows); n == 0 || p.rows[n-1] != row {
+					p.rows = append(p.rows, row)
+				}
+			}
+		}
+		ix.rowBrowsers = append(ix.rowBrowsers, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+func (ix *Index) posting(token string) *posting {
+	p, ok := ix.tokens[token]
+	if !ok {
+		p = &posting{}
+		ix.tokens[token] = p
+	}
+	return p
+}
+
+func browserTokens(browser string) []string {
+	return strings.FieldsFunc(browser, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Len returns the number of rows.
+func (ix *Index) Len() int {
+	return len(ix.names)
+}
+
+// User returns the name, email and browsers of the row.
+func (ix *Index) User(row int) *User {
+	u := &User{Name: ix.names[row], Email: ix.emails[row]}
+	for _, id := range ix.rowBrowsers[row] {
+		u.Browsers = append(u.Browsers, ix.browsers[id])
+	}
+	return u
+}
+
+// Rows returns the ascending rows having a browser containing each of the strings,
+// not necessarily the same one. No strings match no rows.
+func (ix *Index) Rows(subs ...string) []uint32 {
+	if len(subs) == 0 {
+		return nil
+	}
+	lists := make([][]uint32, len(subs))
+	for i, sub := range subs {
+		_, lists[i] = ix.lookup(sub)
+	}
+	// the shortest list first keeps every intersection at most as long as it
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	rows := append([]uint32(nil), lists[0]...)
+	for _, list := range lists[1:] {
+		rows = intersect(rows, list)
+	}
+	return rows
+}
+
+// lookup returns the ascending browsers containing sub and the rows having them.
+// Every letter and digit run of sub is inside a token of such a browser, so the postings
+// of those tokens give the candidates, checked with strings.Contains like FastSearch does.
+func (ix *Index) lookup(sub string) (browsers, rows []uint32) {
+	var candidates []uint32
+	runs := browserTokens(sub)
+	for i, run := range runs {
+		var browserLists, rowLists [][]uint32
+		for token, p := range ix.tokens {
+			if strings.Contains(token, run) {
+				browserLists = append(browserLists, p.browsers)
+				rowLists = append(rowLists, p.rows)
+			}
+		}
+		if i == 0 {
+			candidates, rows = union(browserLists), union(rowLists)
+		} else {
+			candidates = intersect(candidates, union(browserLists))
+		}
+	}
+	if len(runs) == 0 {
+		// nothing to look up, everything is a candidate
+		candidates, rows = upTo(len(ix.browsers)), upTo(ix.Len())
+	}
+
+	found := map[uint32]bool{}
+	for _, id := range candidates {
+		if strings.Contains(ix.browsers[id], sub) {
+			browsers = append(browsers, id)
+			found[id] = true
+		}
+	}
+	res := rows[:0]
+	for _, row := range rows {
+		for _, id := range ix.rowBrowsers[row] {
+			if found[id] {
+				res = append(res, row)
+				break
+			}
+		}
+	}
+	return browsers, res
+}
+
+// upTo returns 0, 1, ..., n-1
+func upTo(n int) []uint32 {
+	list := make([]uint32, n)
+	for i := range list {
+		list[i] = uint32(i)
+	}
+	return list
+}
+
+// union returns the ascending values of the ascending lists, each once
+func union(lists [][]uint32) []uint32 {
+	var res []uint32
+	for _, list := range lists {
+		res = append(res, list...)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	n := 0
+	for i, v := range res {
+		if i == 0 || v != res[n-1] {
+			res[n] = v
+			n++
+		}
+	}
+	return res[:n]
+}
+
+// intersect leaves in a, in place, the values also in b
+func intersect(a, b []uint32) []uint32 {
+	res := a[:0]
+	j := 0
+	for _, v := range a {
+		// gallop over b, it is usually much longer: double the step from j
+		// until it passes v, then bisect the last step
+		step := 1
+		for j+step < len(b) && b[j+step] < v {
+			j += step
+			step *= 2
+		}
+		end := j + step + 1
+		if end > len(b) {
+			end = len(b)
+		}
+		j += sort.Search(end-j, func(k int) bool { return b[j+k] >= v })
+		if j == len(b) {
+			break
+		}
+		if b[j] == v {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Search writes the report of FastSearch for users having browsers containing all
+// of the strings, counting unique browsers containing any of them.
+func (ix *Index) Search(out io.Writer, subs ...string) {
+	report := newSearchReport()
+	report.lines = ix.Len()
+	seen := map[uint32]bool{}
+	for _, sub := range subs {
+		browsers, _ := ix.lookup(sub)
+		for _, id := range browsers {
+			if !seen[id] {
+				seen[id] = true
+				report.seenBrowsers.Add(ix.browsers[id])
+			}
+		}
+	}
+	for _, row := range ix.Rows(subs...) {
+		report.found = append(report.found, foundUser{int(row), ix.names[row], ix.emails[row]})
+	}
+	report.write(out)
+}
+
+// FastSearchIndex is FastSearch answered from the index.
+func FastSearchIndex(out io.Writer, ix *Index) {
+	ix.Search(out, "Android", "MSIE")
+}
+
+// WriteTo writes the index in the format described at Index.
+func (ix *Index) WriteTo(w io.Writer) (int64, error) {
+	e := &indexEncoder{w: bufio.NewWriter(w)}
+	e.write(indexMagic)
+	e.uvarint(uint64(ix.Len()))
+	for _, column := range [][]string{ix.names, ix.emails} {
+		for _, s := range column {
+			e.string(s)
+		}
+	}
+	e.uvarint(uint64(len(ix.browsers)))
+	for _, s := range ix.browsers {
+		e.string(s)
+	}
+	for _, ids := range ix.rowBrowsers {
+		e.uvarint(uint64(len(ids)))
+		for _, id := range ids {
+			e.uvarint(uint64(id))
+		}
+	}
+
+	tokens := make([]string, 0, len(ix.tokens))
+	for token := range ix.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	e.uvarint(uint64(len(tokens)))
+	for _, token := range tokens {
+		p := ix.tokens[token]
+		e.string(token)
+		e.deltas(p.browsers)
+		e.deltas(p.rows)
+	}
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.n, e.err
+}
+
+// indexEncoder keeps the first error, the following writes do nothing
+type indexEncoder struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *indexEncoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	n, err := e.w.Write(b)
+	e.n += int64(n)
+	e.err = err
+}
+
+func (e *indexEncoder) uvarint(v uint64) {
+	e.write(e.buf[:binary.PutUvarint(e.buf[:], v)])
+}
+
+func (e *indexEncoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	if e.err == nil {
+		n, err := e.w.WriteString(s)
+		e.n += int64(n)
+		e.err = err
+	}
+}
+
+func (e *indexEncoder) deltas(list []uint32) {
+	e.uvarint(uint64(len(list)))
+	prev := uint32(0)
+	for _, v := range list {
+		e.uvarint(uint64(v - prev))
+		prev = v
+	}
+}
+
+// OpenIndex reads the index file written by Index.WriteTo.
+func OpenIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := ParseIndex(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ix, nil
+}
+
+var errIndexCorrupt = errors.New("corrupt index")
+
+// ParseIndex decodes an index written by Index.WriteTo.
+func ParseIndex(data []byte) (*Index, error) {
+	if !bytes.HasPrefix(data, indexMagic) {
+		return nil, errors.New("not an index file")
+	}
+	d := &indexDecoder{data: data, pos: len(indexMagic)}
+	ix := &Index{}
+	rows := d.count()
+	ix.names, ix.emails = d.strings(rows), d.strings(rows)
+	ix.browsers = d.strings(d.count())
+	ix.rowBrowsers = make([][]uint32, rows)
+	for row := range ix.rowBrowsers {
+		ids := make([]uint32, d.count())
+		for i := range ids {
+			ids[i] = d.id(len(ix.browsers))
+		}
+		ix.rowBrowsers[row] = ids
+	}
+	tokens := d.count()
+	ix.tokens = make(map[string]*posting, tokens)
+	for i := 0; i < tokens && d.err == nil; i++ {
+		token := d.string()
+		ix.tokens[token] = &posting{
+			browsers: d.deltas(len(ix.browsers)),
+			rows:     d.deltas(rows),
+		}
+	}
+	if d.err == nil && d.pos != len(data) {
+		d.err = errIndexCorrupt
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("offset %d: %v", d.pos, d.err)
+	}
+	return ix, nil
+}
+
+// indexDecoder keeps the first error, after it everything decodes as zero
+type indexDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *indexDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.err = errIndexCorrupt
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// count reads a length, every counted item takes at least a byte,
+// so larger ones can't be right and would only waste memory
+func (d *indexDecoder) count() int {
+	v := d.uvarint()
+	if v > uint64(len(d.data)-d.pos) {
+		d.err = errIndexCorrupt
+		return 0
+	}
+	return int(v)
+}
+
+// id reads a value below n
+func (d *indexDecoder) id(n int) uint32 {
+	v := d.uvarint()
+	if v >= uint64(n) {
+		d.err = errIndexCorrupt
+		return 0
+	}
+	return uint32(v)
+}
+
+func (d *indexDecoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.data[d.pos : d.pos+n])
+	d.pos += n
+	return s
+}
+
+func (d *indexDecoder) strings(n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+// deltas reads an ascending list of values below n
+func (d *indexDecoder) deltas(n int) []uint32 {
+	list := make([]uint32, d.count())
+	v := uint64(0)
+	for i := range list {
+		delta := d.uvarint()
+		if i > 0 && delta == 0 || delta >= uint64(n)-v {
+			d.err = errIndexCorrupt
+			return nil
+		}
+		v += delta
+		list[i] = uint32(v)
+	}
+	return list
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// usersIndex строит индекс data/users.txt
+func usersIndex(tb testing.TB) *Index {
+	tb.Helper()
+	file, err := os.Open(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+	ix, err := NewIndex(file)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return ix
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := usersIndex(t)
+
+	fastOut, indexOut := new(bytes.Buffer), new(bytes.Buffer)
+	FastSearch(fastOut)
+	FastSearchIndex(indexOut, ix)
+	if indexOut.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", indexOut.String(), fastOut.String())
+	}
+
+	// после записи и чтения индекс тот же
+	buf := new(bytes.Buffer)
+	n, err := ix.WriteTo(buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo: %v, %d of %d bytes", err, n, buf.Len())
+	}
+	read, err := ParseIndex(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, ix) {
+		t.Errorf("read index differs")
+	}
+	if u := read.User(0); u.Name != ix.names[0] || len(u.Browsers) != len(ix.rowBrowsers[0]) {
+		t.Errorf("wrong user %+v", u)
+	}
+}
+
+func TestIndexRows(t *testing.T) {
+	users := strings.Join([]string{
+		`{"browsers":["Mozilla/5.0 (Linux; Android 4.0)","Opera/9.80 (J2ME/MIDP)"],"name":"a"}`,
+		`{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0)"],"name":"b"}`,
+		`{"browsers":["Mozilla/4.0 (compatible; MSIE 6.0; Android)"],"name":"c"}`,
+		`{"name":"d"}`,
+		`{"browsers":["Opera/9.80 (J2ME/MIDP)","Mozilla/4.0 (compatible; MSIE 7.0)","Android"],"name":"e"}`,
+	}, "\n")
+	ix, err := NewIndex(strings.NewReader(users))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Len() != 5 || len(ix.browsers) != 5 {
+		t.Errorf("wrong index: %d rows, %d browsers", ix.Len(), len(ix.browsers))
+	}
+	cases := []struct {
+		tokens   []string
+		expected []uint32
+	}{
+		{[]string{"Android"}, []uint32{0, 2, 4}},
+		{[]string{"MSIE", "Android"}, []uint32{2, 4}},
+		{[]string{"Android", "Opera", "MSIE"}, []uint32{4}},
+		{[]string{"Mozilla", "Mozilla"}, []uint32{0, 1, 2, 4}},
+		{[]string{"MSI"}, []uint32{1, 2, 4}},
+		{[]string{"(compatible; MSIE 6"}, []uint32{2}},
+		{[]string{"Android", "Safari"}, nil},
+		{[]string{"/"}, []uint32{0, 1, 2, 4}},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		if got := ix.Rows(c.tokens...); !reflect.DeepEqual(got, c.expected) && len(got)+len(c.expected) > 0 {
+			t.Errorf("rows of %v\nGot: %v\nExpected: %v", c.tokens, got, c.expected)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	ix.Search(out, "Opera", "MIDP")
+	expected := "found users:\n[0] a <>\n[4] e <>\n\nTotal unique browsers 1\n"
+	if out.String() != expected {
+		t.Errorf("wrong report\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+}
+
+func TestIndexSubstrings(t *testing.T) {
+	// FastSearch ищет подстроки, а не токены: Android внутри AndroidDownloadManager и Android4
+	users := strings.Join([]string{
+		`{"browsers":["AndroidDownloadManager/5.1 (Linux; U; 5.1; Nexus 5)","Mozilla/4.0 (compatible; MSIE 8.0)"],"name":"a","email":"a@x"}`,
+		`{"browsers":["Dalvik/1.6.0 (Linux; U; Android4.4)","Mozilla/4.0 (compatible; MSIE 7.0)"],"name":"b","email":"b@x"}`,
+		`{"browsers":["Mozilla/5.0 (Linux; Android 4.0)"],"name":"c","email":"c@x"}`,
+	}, "\n")
+	ix, err := NewIndex(strings.NewReader(users))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastOut, indexOut := new(bytes.Buffer), new(bytes.Buffer)
+	if err := FastSearchFrom(fastOut, strings.NewReader(users)); err != nil {
+		t.Fatal(err)
+	}
+	FastSearchIndex(indexOut, ix)
+	expected := "found users:\n[0] a <a [at] x>\n[1] b <b [at] x>\n\nTotal unique browsers 5\n"
+	if fastOut.String() != expected || indexOut.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nFastSearch:\n%v\nExpected:\n%v", indexOut.String(), fastOut.String(), expected)
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	var long []uint32
+	for i := uint32(0); i < 1000; i += 3 {
+		long = append(long, i)
+	}
+	cases := []struct {
+		a, expected []uint32
+	}{
+		{[]uint32{0, 1, 3, 500, 501, 996, 999, 1002}, []uint32{0, 3, 501, 996, 999}},
+		// после длинного прыжка следующий элемент близко
+		{[]uint32{900, 903, 904, 906}, []uint32{900, 903, 906}},
+		{[]uint32{2, 998}, nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		got := intersect(append([]uint32(nil), c.a...), long)
+		if !reflect.DeepEqual(got, c.expected) && len(got)+len(c.expected) > 0 {
+			t.Errorf("intersect %v\nGot: %v\nExpected: %v", c.a, got, c.expected)
+		}
+	}
+}
+
+func TestParseIndexCorrupt(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if _, err := usersIndex(t).WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// любое усечение ломает индекс
+	for _, n := range []int{0, 5, len(indexMagic), len(indexMagic) + 1, len(data) / 2, len(data) - 1} {
+		if _, err := ParseIndex(data[:n]); err == nil {
+			t.Errorf("expected error for %d of %d bytes", n, len(data))
+		}
+	}
+	if _, err := ParseIndex(append(data[:len(data):len(data)], 0)); err == nil {
+		t.Errorf("expected error for trailing data")
+	}
+}
+
+// go test -fuzz FuzzParseIndex
+func FuzzParseIndex(f *testing.F) {
+	ix, err := NewIndex(strings.NewReader(`{"browsers":["Mozilla/4.0 (MSIE 6.0; Android)","Opera"],"name":"a","email":"a@b"}` + "\n{}"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	ix.WriteTo(buf)
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ix, err := ParseIndex(data)
+		if err != nil {
+			return
+		}
+		// разобранный индекс можно использовать, записать и прочитать снова
+		for row := 0; row < ix.Len(); row++ {
+			ix.User(row)
+		}
+		for token := range ix.tokens {
+			ix.Rows(token, "MSIE")
+		}
+		out := new(bytes.Buffer)
+		if _, err := ix.WriteTo(out); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ParseIndex(out.Bytes())
+		if err != nil || !reflect.DeepEqual(read, ix) {
+			t.Errorf("index read back differs (%v)", err)
+		}
+	})
+}
+
+func TestIndexCLI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.idx")
+	out := new(bytes.Buffer)
+	if err := run([]string{"-build-index", path}, nil, out); err != nil || out.Len() != 0 {
+		t.Fatalf("build: %v %q", err, out.String())
+	}
+	if err := run([]string{"-index", path}, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), fastOut.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"-index", path, "-tokens", "Android,Opera,MSIE", "-redact", "email=drop"}, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "found users:\n[") || strings.Contains(out.String(), "<") {
+		t.Errorf("wrong report:\n%v", out.String())
+	}
+
+	for _, args := range [][]string{
+		{"-index", path, "-slow"},
+		{"-index", path, "-group", "country"},
+		{"-index", path, "users.txt"},
+		{"-build-index", path, "-distinct", "email"},
+		{"-index", filePath},
+		{"-index", path, "-approx", "10"},
+		{"-index", path, "-workers", "4"},
+	} {
+		if err := run(args, nil, out); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func BenchmarkIndexBuild(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		usersIndex(b)
+	}
+}
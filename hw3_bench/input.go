@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compression names the format of data starting with magic, "" if it's not compressed
+func compression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
+
+// Decompress returns r decompressed if it is gzip or zstd compressed, or r as it is.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch compression(magic) {
+	case "gzip":
+		return gzip.NewReader(br)
+	case "zstd":
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReader{d}, nil
+	}
+	return io.NopCloser(br), nil
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r zstdReader) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// usersFile closes the decompressor and then the file
+type usersFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (f usersFile) Close() error {
+	err := f.ReadCloser.Close()
+	if ferr := f.file.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// OpenUsers opens the users file at path, or stdin if path is "-", decompressing it if needed.
+func OpenUsers(path string, stdin io.Reader) (io.ReadCloser, error) {
+	if path == "-" {
+		return Decompress(stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return usersFile{r, f}, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// первые 50 строк users.txt, сжатые zstd
+const zstdFile = "./data/users_head.txt.zst"
+
+func usersHead(t *testing.T) string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 51)
+	return strings.Join(lines[:50], "\n")
+}
+
+func TestOpenUsers(t *testing.T) {
+	head := usersHead(t)
+
+	gz := new(bytes.Buffer)
+	w := gzip.NewWriter(gz)
+	w.Write([]byte(head))
+	w.Close()
+	gzFile := filepath.Join(t.TempDir(), "users.txt.gz")
+	if err := os.WriteFile(gzFile, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path  string
+		stdin string
+	}{
+		{zstdFile, ""},
+		{gzFile, ""},
+		{"-", gz.String()},
+		{"-", head},
+	}
+	for _, c := range cases {
+		r, err := OpenUsers(c.path, strings.NewReader(c.stdin))
+		if err != nil {
+			t.Errorf("%s: %v", c.path, err)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		_, err = buf.ReadFrom(r)
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil || buf.String() != head {
+			t.Errorf("%s: wrong data read (%v)\nGot: %.100q\nExpected: %.100q", c.path, err, buf.String(), head)
+		}
+	}
+
+	if _, err := OpenUsers(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestSearchCLI(t *testing.T) {
+	expected := new(bytes.Buffer)
+	if err := SlowSearchFrom(expected, strings.NewReader(usersHead(t))); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{zstdFile}, {"-slow", zstdFile}, {"-workers", "0", zstdFile}} {
+		out := new(bytes.Buffer)
+		if err := run(args, nil, out); err != nil || out.String() != expected.String() {
+			t.Errorf("%v: results not match (%v)\nGot:\n%v\nExpected:\n%v", args, err, out.String(), expected.String())
+		}
+	}
+
+	full := new(bytes.Buffer)
+	SlowSearch(full)
+	out := new(bytes.Buffer)
+	if err := run([]string{"-workers", "4"}, nil, out); err != nil || out.String() != full.String() {
+		t.Errorf("parallel results not match (%v)\nGot:\n%v\nExpected:\n%v", err, out.String(), full.String())
+	}
+
+	if err := run([]string{"-"}, strings.NewReader("{}\nnot json"), out); err == nil {
+		t.Errorf("expected error for bad input")
+	}
+	if err := SlowSearchFrom(out, strings.NewReader("not json")); err == nil {
+		t.Errorf("expected error from SlowSearchFrom")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/mailru/easyjson/jlexer"
+)
+
+// lineDecoder adds a users line to the report. Decoders keep state between lines,
+// every goroutine needs its own.
+type lineDecoder func(report *searchReport, i int, line []byte) error
+
+func newEasyjsonDecoder() lineDecoder {
+	user := &User{}
+	return func(report *searchReport, i int, line []byte) error {
+		*user = User{Browsers: user.Browsers[:0]}
+		if err := user.unmarshalSearchJSON(line); err != nil {
+			return err
+		}
+		report.add(i, user)
+		return nil
+	}
+}
+
+// unmarshalSearchJSON decodes only the fields FastSearch reports, browsers, email and name,
+// and skips the rest. It is written by hand, fast_easyjson.go is generated.
+func (u *User) unmarshalSearchJSON(data []byte) error {
+	in := jlexer.Lexer{Data: data}
+	if in.IsNull() {
+		in.Skip()
+		in.Consumed()
+		return in.Error()
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "browsers":
+			in.Delim('[')
+			u.Browsers = u.Browsers[:0]
+			for !in.IsDelim(']') {
+				u.Browsers = append(u.Browsers, in.String())
+				in.WantComma()
+			}
+			in.Delim(']')
+		case "email":
+			u.Email = in.String()
+		case "name":
+			u.Name = in.String()
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	in.Consumed()
+	return in.Error()
+}
+
+func newRawDecoder() lineDecoder {
+	user := &RawUser{}
+	return func(report *searchReport, i int, line []byte) error {
+		if err := user.Scan(line); err != nil {
+			return err
+		}
+		report.addRaw(i, user)
+		return nil
+	}
+}
+
+// searchReader decodes the lines of r read with bufio.Scanner.
+func searchReader(r io.Reader, decode lineDecoder) (*searchReport, error) {
+	report := newSearchReport()
+	err := scanLines(r, func(i int, line []byte) error {
+		return decode(report, i, line)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// scanLines calls fn for every line of r, up to 1MB long. Errors are
+// returned with the line number.
+func scanLines(r io.Reader, fn func(i int, line []byte) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for i := 0; s.Scan(); i++ {
+		if err := fn(i, s.Bytes()); err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return s.Err()
+}
+
+// searchBytes decodes the lines of data, they are handed out as slices of data.
+// Lines are split as by bufio.ScanLines.
+func searchBytes(data []byte, decode lineDecoder) (*searchReport, error) {
+	report := newSearchReport()
+	for i := 0; len(data) > 0; i++ {
+		line := data
+		if n := bytes.IndexByte(data, '\n'); n >= 0 {
+			line, data = data[:n], data[n+1:]
+		} else {
+			data = nil
+		}
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if err := decode(report, i, line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return report, nil
+}
+
+// searchBytesParallel is searchChunks over data, the chunks are handed out as slices of it.
+func searchBytesParallel(data []byte, workers int, newDecoder func() lineDecoder) (*searchReport, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// reading a bytes.Reader doesn't fail
+	ends, _ := chunkEnds(bytes.NewReader(data), int64(len(data)), workers)
+	starts := make([]int64, len(ends))
+	for i := 1; i < len(ends); i++ {
+		starts[i] = ends[i-1]
+	}
+	return searchEachChunk(starts, func(i int) (*searchReport, error) {
+		return searchBytes(data[starts[i]:ends[i]], newDecoder())
+	})
+}
+
+// FastSearchMmap is FastSearch over the memory mapped file, parsed in chunks
+// on workers goroutines, GOMAXPROCS if 0.
+func FastSearchMmap(out io.Writer, workers int) {
+	report, err := searchMapped(filePath, workers, newEasyjsonDecoder)
+	if err != nil {
+		panic(err)
+	}
+	report.write(out)
+}
+
+func searchMapped(path string, workers int, newDecoder func() lineDecoder) (*searchReport, error) {
+	m, err := MapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	if workers == 1 {
+		return searchBytes(m.Bytes(), newDecoder())
+	}
+	return searchBytesParallel(m.Bytes(), workers, newDecoder)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFastSearchMmap(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	for _, workers := range []int{1, 0, 3} {
+		out := new(bytes.Buffer)
+		FastSearchMmap(out, workers)
+		if out.String() != slowOut.String() {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, out.String(), slowOut.String())
+		}
+
+		report, err := searchMapped(filePath, workers, newRawDecoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		report.write(out)
+		if out.String() != slowOut.String() {
+			t.Errorf("%d workers, raw: results not match\nGot:\n%v\nExpected:\n%v", workers, out.String(), slowOut.String())
+		}
+	}
+}
+
+func TestSearchBytes(t *testing.T) {
+	// строки режутся как в bufio.ScanLines: \r\n и перевод строки в конце
+	data := "{\"name\":\"a\"}\r\n{\"name\":\"b\\u0040\",\"browsers\":[\"Android\",\"MSIE\"]}\n"
+	for _, workers := range []int{1, 2, 5} {
+		report, err := searchBytesParallel([]byte(data), workers, newRawDecoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.lines != 2 || len(report.found) != 1 || report.found[0] != (foundUser{1, "b@", ""}) {
+			t.Errorf("%d workers: wrong report %+v", workers, report)
+		}
+	}
+
+	if _, err := searchBytesParallel([]byte("{}\n{\n{}"), 2, newRawDecoder); err == nil {
+		t.Errorf("expected error for broken line")
+	}
+}
+
+func TestSearchJSONFields(t *testing.T) {
+	line := []byte(`{"browsers":["Android"],"company":"Acme","country":"Peru","email":"a@b","job":"x","name":"A","phone":"1"}`)
+	full, search := &User{}, &User{}
+	if err := full.UnmarshalJSON(line); err != nil {
+		t.Fatal(err)
+	}
+	if err := search.unmarshalSearchJSON(line); err != nil {
+		t.Fatal(err)
+	}
+	if full.Company != "Acme" || full.Phone != "1" {
+		t.Errorf("fields not decoded: %+v", full)
+	}
+	// для FastSearch лишние поля пропускаются
+	expected := User{Browsers: []string{"Android"}, Email: "a@b", Name: "A"}
+	if search.Name != expected.Name || search.Email != expected.Email || len(search.Browsers) != 1 || search.Company != "" || search.Phone != "" {
+		t.Errorf("Got: %+v\nExpected: %+v", search, expected)
+	}
+}
+
+func TestMapFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.txt")
+	data := `{"name":"AB","browsers":["Android \/ MSIE"]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := searchMapped(path, 1, newRawDecoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.found) != 1 || report.found[0].name != "AB" {
+		t.Errorf("wrong report %+v", report)
+	}
+	// распаковка escape-последовательностей на месте не меняет файл
+	if after, _ := os.ReadFile(path); string(after) != data {
+		t.Errorf("file modified\nGot: %s\nExpected: %s", after, data)
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	os.WriteFile(empty, nil, 0644)
+	m, err := MapFile(empty)
+	if err != nil || len(m.Bytes()) != 0 {
+		t.Errorf("empty file mapped as %q (%v)", m.Bytes(), err)
+	}
+	if err := m.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := MapFile(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
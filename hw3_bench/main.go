@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	slow := flags.Bool("slow", false, "use SlowSearch")
+	workers := flags.Int("workers", 1, "parse uncompressed files on this many goroutines, 0 for one per CPU")
+	where := flags.String("where", "", "aggregate only the users matching this query, see Query")
+	groupBy := flags.String("group", "", "aggregate users by these comma separated fields instead of the search report")
+	distinct := flags.String("distinct", "", "count different values of this field in every group")
+	top := flags.String("top", "", "list the most frequent values of this field in every group")
+	topN := flags.Int("n", 5, "number of -top values")
+	limit := flags.Int("limit", 0, "show only this many largest groups, 0 for all")
+	format := flags.String("format", "table", "aggregation output format: table, csv or json")
+	approx := flags.Uint("approx", 0, "count unique browsers and -distinct values with HyperLogLog of this precision, 4 to 18, instead of exactly")
+	redact := flags.String("redact", "", "redact fields in the output, like email=partial:2,name=mask, see Redaction")
+	buildIndex := flags.String("build-index", "", "write the index of the users to this file instead of searching")
+	index := flags.String("index", "", "search this index file, see Index, instead of users")
+	tokens := flags.String("tokens", "Android,MSIE", "comma separated strings users searched in -index have to have in their browsers")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: search [flags] [file]\nreads %s if no file given and stdin for -, gzip and zstd files are decompressed\n", filePath)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *approx != 0 && (*approx < 4 || *approx > 18) {
+		return fmt.Errorf("-approx %d out of 4..18", *approx)
+	}
+	if *slow && *approx != 0 {
+		return errors.New("-approx can't be used with -slow, it counts exactly")
+	}
+	defer func(p uint8) { ApproxPrecision = p }(ApproxPrecision)
+	ApproxPrecision = uint8(*approx)
+	policy, err := ParseRedactions(*redact)
+	if err != nil {
+		return err
+	}
+	defer func(p RedactionPolicy) { Redactions = p }(Redactions)
+	Redactions = Redactions.With(policy)
+
+	path := filePath
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		path = flags.Arg(0)
+	default:
+		return fmt.Errorf("expected one file, got %d", flags.NArg())
+	}
+
+	aggregate := *where != "" || *groupBy != "" || *distinct != "" || *top != ""
+	if *index != "" {
+		if aggregate || *slow || *buildIndex != "" || flags.NArg() != 0 {
+			return errors.New("-index can't be used with other inputs, -build-index, -slow or aggregations")
+		}
+		if *approx != 0 || *workers != 1 {
+			return errors.New("-index counts exactly on one goroutine, it can't be used with -approx or -workers")
+		}
+		ix, err := OpenIndex(*index)
+		if err != nil {
+			return err
+		}
+		ix.Search(stdout, strings.Split(*tokens, ",")...)
+		return nil
+	}
+	if *buildIndex != "" && (aggregate || *slow) {
+		return errors.New("-build-index can't be used with -slow or aggregations")
+	}
+	if aggregate && *format != "table" && *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if !aggregate && !*slow && *buildIndex == "" && *workers != 1 && path != "-" {
+		if ok, err := searchParallel(stdout, path, *workers); ok || err != nil {
+			return err
+		}
+	}
+
+	r, err := OpenUsers(path, stdin)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if *buildIndex != "" {
+		return writeIndex(*buildIndex, r)
+	}
+	if aggregate {
+		a := &Aggregation{Distinct: *distinct, Top: *top, TopN: *topN, Limit: *limit}
+		if *groupBy != "" {
+			a.GroupBy = strings.Split(*groupBy, ",")
+		}
+		// fail before reading all the users
+		if err := Redactions.checkGroupBy(a.GroupBy); err != nil {
+			return err
+		}
+		if *where != "" {
+			if a.Where, err = ParseQuery(*where); err != nil {
+				return err
+			}
+		}
+		rep, err := a.Run(r)
+		if err != nil {
+			return err
+		}
+		return rep.Write(stdout, *format)
+	}
+	if *slow {
+		if len(policy) == 0 {
+			return SlowSearchFrom(stdout, r)
+		}
+		// SlowSearch stays the plain reference, its report is redacted afterwards
+		report := new(bytes.Buffer)
+		if err := SlowSearchFrom(report, r); err != nil {
+			return err
+		}
+		return redactSearchReport(stdout, report.Bytes())
+	}
+	return FastSearchFrom(stdout, r)
+}
+
+func writeIndex(path string, r io.Reader) error {
+	ix, err := NewIndex(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := ix.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// searchParallel runs FastSearchParallelFrom if path is an uncompressed regular file,
+// the chunks have to be read at random. ok reports whether it did.
+func searchParallel(out io.Writer, path string, workers int) (ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	magic := make([]byte, len(zstdMagic))
+	n, _ := f.ReadAt(magic, 0)
+	if !info.Mode().IsRegular() || compression(magic[:n]) != "" {
+		return false, nil
+	}
+	return true, FastSearchParallelFrom(out, f, info.Size(), workers)
+}
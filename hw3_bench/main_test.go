@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -45,6 +46,72 @@ func BenchmarkFast(b *testing.B) {
 	}
 }
 
+func BenchmarkFastRaw(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		FastSearchRaw(ioutil.Discard)
+	}
+}
+
+func BenchmarkFastParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		FastSearchParallel(ioutil.Discard, 0)
+	}
+}
+
+// поиск по готовому индексу, без его построения
+func BenchmarkFastIndex(b *testing.B) {
+	ix := usersIndex(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FastSearchIndex(ioutil.Discard, ix)
+	}
+}
+
+// матрица способов чтения: bufio, mmap и mmap по кускам параллельно,
+// каждый с easyjson и с RawUser.Scan
+func BenchmarkInput(b *testing.B) {
+	decoders := []struct {
+		name string
+		new  func() lineDecoder
+	}{
+		{"easyjson", newEasyjsonDecoder},
+		{"raw", newRawDecoder},
+	}
+	inputs := []struct {
+		name   string
+		search func(newDecoder func() lineDecoder) (*searchReport, error)
+	}{
+		{"bufio", func(newDecoder func() lineDecoder) (*searchReport, error) {
+			file, err := os.Open(filePath)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			return searchReader(file, newDecoder())
+		}},
+		{"mmap", func(newDecoder func() lineDecoder) (*searchReport, error) {
+			return searchMapped(filePath, 1, newDecoder)
+		}},
+		{"mmap-parallel", func(newDecoder func() lineDecoder) (*searchReport, error) {
+			return searchMapped(filePath, 0, newDecoder)
+		}},
+	}
+	for _, in := range inputs {
+		for _, dec := range decoders {
+			b.Run(in.name+"/"+dec.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					report, err := in.search(dec.new)
+					if err != nil {
+						b.Fatal(err)
+					}
+					report.write(ioutil.Discard)
+				}
+			})
+		}
+	}
+}
+
 //: go tool pprof *имя файла*
 /*
 	go test --bench .
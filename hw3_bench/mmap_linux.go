@@ -0,0 +1,50 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// MappedFile is a file mapped into memory.
+type MappedFile struct {
+	data []byte
+}
+
+// MapFile maps the file at path. The mapping is private: writes to Bytes,
+// like the in place unescaping of RawUser.Scan, don't reach the file.
+func MapFile(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// an empty mapping is an error
+	if info.Size() == 0 {
+		return &MappedFile{}, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	return &MappedFile{data: data}, nil
+}
+
+// Bytes returns the file contents, valid until Close.
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+func (m *MappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// MappedFile is the file contents read into memory, there is no mmap here.
+type MappedFile struct {
+	data []byte
+}
+
+func MapFile(path string) (*MappedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{data: data}, nil
+}
+
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+func (m *MappedFile) Close() error {
+	m.data = nil
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// splitLines cuts r of size bytes into about n chunks, every one ending after a newline
+// or at the end of r. There are fewer chunks if some lines are longer than a chunk.
+func splitLines(r io.ReaderAt, size int64, n int) ([]*io.SectionReader, error) {
+	ends, err := chunkEnds(r, size, n)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]*io.SectionReader, len(ends))
+	start := int64(0)
+	for i, end := range ends {
+		chunks[i] = io.NewSectionReader(r, start, end-start)
+		start = end
+	}
+	return chunks, nil
+}
+
+// chunkEnds returns the offsets where the chunks of splitLines end
+func chunkEnds(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	if n < 1 {
+		n = 1
+	}
+	var ends []int64
+	buf := make([]byte, 4096)
+	start := int64(0)
+	for k := 1; k <= n && start < size; k++ {
+		end := size * int64(k) / int64(n)
+		if end < start {
+			end = start
+		}
+		// the chunk goes on to the end of the line holding its last byte
+		for end < size {
+			m, err := r.ReadAt(buf, end)
+			if i := bytes.IndexByte(buf[:m], '\n'); i >= 0 {
+				end += int64(i) + 1
+				break
+			}
+			end += int64(m)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if end > size {
+			end = size
+		}
+		if end > start {
+			ends = append(ends, end)
+		}
+		start = end
+	}
+	return ends, nil
+}
+
+// FastSearchParallel is FastSearch parsing the file in chunks on workers goroutines,
+// GOMAXPROCS if workers is 0.
+func FastSearchParallel(out io.Writer, workers int) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := FastSearchParallelFrom(out, file, info.Size(), workers); err != nil {
+		panic(err)
+	}
+}
+
+// FastSearchParallelFrom is FastSearchParallel over the size bytes of users in r.
+func FastSearchParallelFrom(out io.Writer, r io.ReaderAt, size int64, workers int) error {
+	report, err := searchChunks(r, size, workers, newEasyjsonDecoder)
+	if err != nil {
+		return err
+	}
+	report.write(out)
+	return nil
+}
+
+// searchChunks is searchReader over chunks of r on workers goroutines, GOMAXPROCS if 0.
+func searchChunks(r io.ReaderAt, size int64, workers int, newDecoder func() lineDecoder) (*searchReport, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunks, err := splitLines(r, size, workers)
+	if err != nil {
+		return nil, err
+	}
+	starts := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		_, starts[i], _ = chunk.Outer()
+	}
+	return searchEachChunk(starts, func(i int) (*searchReport, error) {
+		return searchReader(chunks[i], newDecoder())
+	})
+}
+
+// searchEachChunk runs search for every chunk on its own goroutine, starts are
+// the offsets of the chunks. The reports are merged in file order, so user numbers
+// come out as in FastSearch.
+func searchEachChunk(starts []int64, search func(i int) (*searchReport, error)) (*searchReport, error) {
+	reports := make([]*searchReport, len(starts))
+	errs := make([]error, len(starts))
+	wg := &sync.WaitGroup{}
+	for i := range starts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i], errs[i] = search(i)
+		}(i)
+	}
+	wg.Wait()
+
+	report := newSearchReport()
+	for i := range reports {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("chunk at byte %d: %w", starts[i], errs[i])
+		}
+		report.merge(reports[i])
+	}
+	return report, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFastSearchParallel(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	for _, workers := range []int{0, 1, 2, 3, 7, 64, 5000} {
+		out := new(bytes.Buffer)
+		FastSearchParallel(out, workers)
+		if out.String() != slowOut.String() {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, out.String(), slowOut.String())
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	data := "aaaa\nb\n\ncccccccccc\nd"
+	for n := 1; n <= len(data)+1; n++ {
+		chunks, err := splitLines(strings.NewReader(data), int64(len(data)), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		joined := ""
+		for _, c := range chunks {
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(c)
+			// каждый кусок, кроме последнего, заканчивается переводом строки
+			if c != chunks[len(chunks)-1] && !strings.HasSuffix(buf.String(), "\n") {
+				t.Errorf("%d chunks: chunk %q cuts a line", n, buf.String())
+			}
+			joined += buf.String()
+		}
+		if joined != data || len(chunks) > n {
+			t.Errorf("%d chunks: wrong split %d chunks\nGot: %q\nExpected: %q", n, len(chunks), joined, data)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// Query selects users. Build it with Where, And, Or, Not or parse it with ParseQuery:
+//
+//	browsers contains "Android" and browsers contains "MSIE"
+//	country in ("Peru", "Chile") and not (job = "Manager" or name ~ `^A`)
+//
+// Operators are contains, equals (=), matches (~) with a regexp, and in with a list of values.
+// A predicate on browsers holds if it holds for any of the user's browsers.
+// So do the predicates on family, version, os and device, parsed from browsers
+// with ParseUserAgent, each on its own: family = "IE" and os = "Android" may hold
+// for two different browsers. browser(...) makes them hold for the same one:
+//
+//	browser(family = "IE" and version ~ `^[5-9]\.`)
+type Query interface {
+	Match(u *User) bool
+	String() string
+}
+
+// userFields report whether match holds for any value of the field
+var userFields = map[string]func(u *User, match func(string) bool) bool{
+	"browsers": func(u *User, match func(string) bool) bool {
+		for _, b := range u.Browsers {
+			if match(b) {
+				return true
+			}
+		}
+		return false
+	},
+	"company": func(u *User, match func(string) bool) bool { return match(u.Company) },
+	"country": func(u *User, match func(string) bool) bool { return match(u.Country) },
+	"email":   func(u *User, match func(string) bool) bool { return match(u.Email) },
+	"job":     func(u *User, match func(string) bool) bool { return match(u.Job) },
+	"name":    func(u *User, match func(string) bool) bool { return match(u.Name) },
+	"phone":   func(u *User, match func(string) bool) bool { return match(u.Phone) },
+	"family":  anyUserAgent(uaFields["family"]),
+	"version": anyUserAgent(uaFields["version"]),
+	"os":      anyUserAgent(uaFields["os"]),
+	"device":  anyUserAgent(uaFields["device"]),
+}
+
+func anyUserAgent(get func(ua UserAgent) string) func(u *User, match func(string) bool) bool {
+	return func(u *User, match func(string) bool) bool {
+		for _, b := range u.Browsers {
+			if match(get(ParseUserAgent(b))) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type predicate struct {
+	field string
+	op    string
+	args  []string
+	any   func(u *User, match func(string) bool) bool
+	match func(string) bool
+}
+
+// Where is the predicate "field op args", op is one of contains, equals, matches and in.
+func Where(field, op string, args ...string) (Query, error) {
+	any, ok := userFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	if op != "in" && len(args) != 1 {
+		return nil, fmt.Errorf("%s takes one value, got %d", op, len(args))
+	}
+	p := &predicate{field: field, op: op, args: args, any: any}
+	switch op {
+	case "contains":
+		sub := args[0]
+		p.match = func(s string) bool { return strings.Contains(s, sub) }
+	case "equals":
+		value := args[0]
+		p.match = func(s string) bool { return s == value }
+	case "matches":
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		p.match = re.MatchString
+	case "in":
+		set := make(map[string]struct{}, len(args))
+		for _, a := range args {
+			set[a] = struct{}{}
+		}
+		p.match = func(s string) bool {
+			_, ok := set[s]
+			return ok
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	return p, nil
+}
+
+func (p *predicate) Match(u *User) bool {
+	return p.any(u, p.match)
+}
+
+func (p *predicate) String() string {
+	args := make([]string, len(p.args))
+	for i, a := range p.args {
+		args[i] = strconv.Quote(a)
+	}
+	if p.op == "in" {
+		return p.field + " in (" + strings.Join(args, ", ") + ")"
+	}
+	return p.field + " " + p.op + " " + args[0]
+}
+
+type and []Query
+type or []Query
+type not struct{ Query }
+
+// And matches users matched by all qs, it matches everybody if qs is empty.
+func And(qs ...Query) Query { return and(qs) }
+
+// Or matches users matched by any of qs, it matches nobody if qs is empty.
+func Or(qs ...Query) Query { return or(qs) }
+
+func Not(q Query) Query { return not{q} }
+
+func (qs and) Match(u *User) bool {
+	for _, q := range qs {
+		if !q.Match(u) {
+			return false
+		}
+	}
+	return true
+}
+
+func (qs or) Match(u *User) bool {
+	for _, q := range qs {
+		if q.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q not) Match(u *User) bool { return !q.Query.Match(u) }
+
+type anyBrowser struct{ Query }
+
+// AnyBrowser matches users with a browser that q matches as if it was the user's only one.
+func AnyBrowser(q Query) Query { return anyBrowser{q} }
+
+func (q anyBrowser) Match(u *User) bool {
+	one := *u
+	var browser [1]string
+	one.Browsers = browser[:]
+	for _, b := range u.Browsers {
+		browser[0] = b
+		if q.Query.Match(&one) {
+			return true
+		}
+	}
+	return false
+}
+
+func (qs and) String() string       { return joinQueries(qs, " and ") }
+func (qs or) String() string        { return joinQueries(qs, " or ") }
+func (q not) String() string        { return "not (" + q.Query.String() + ")" }
+func (q anyBrowser) String() string { return "browser(" + q.Query.String() + ")" }
+
+func joinQueries(qs []Query, sep string) string {
+	parts := make([]string, len(qs))
+	for i, q := range qs {
+		parts[i] = "(" + q.String() + ")"
+	}
+	return strings.Join(parts, sep)
+}
+
+// ScanUsers decodes users from JSON lines and calls fn with the ones matching q, nil q matches all.
+// i is the line number counting from 0. u is reused for the next line, so fn must copy what it keeps.
+func ScanUsers(r io.Reader, q Query, fn func(i int, u *User)) error {
+	user := &User{}
+	return scanLines(r, func(i int, line []byte) error {
+		*user = User{Browsers: user.Browsers[:0]}
+		if err := user.UnmarshalJSON(line); err != nil {
+			return err
+		}
+		if q == nil || q.Match(user) {
+			fn(i, user)
+		}
+		return nil
+	})
+}
+
+var queryOps = map[string]string{
+	"contains": "contains",
+	"equals":   "equals",
+	"=":        "equals",
+	"matches":  "matches",
+	"~":        "matches",
+	"in":       "in",
+}
+
+// ParseQuery parses a query in the syntax shown at Query.
+// Values are Go string literals, "..." or `...`. and binds tighter than or.
+func ParseQuery(src string) (Query, error) {
+	p := &queryParser{}
+	p.s.Init(strings.NewReader(src))
+	p.s.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings
+	p.s.Error = func(s *scanner.Scanner, msg string) { p.fail(msg) }
+	p.next()
+	q := p.or()
+	if p.tok != scanner.EOF {
+		p.fail("unexpected " + p.s.TokenText())
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("query %q: %v", src, p.err)
+	}
+	return q, nil
+}
+
+func MustParseQuery(src string) Query {
+	q, err := ParseQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+type queryParser struct {
+	s   scanner.Scanner
+	tok rune
+	err error
+}
+
+func (p *queryParser) fail(msg string) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%s: %s", p.s.Position, msg)
+	}
+}
+
+func (p *queryParser) next() {
+	p.tok = p.s.Scan()
+}
+
+func (p *queryParser) keyword(word string) bool {
+	if p.tok == scanner.Ident && strings.EqualFold(p.s.TokenText(), word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(tok rune) {
+	if p.tok != tok {
+		p.fail(fmt.Sprintf("expected %s, got %s", scanner.TokenString(tok), p.s.TokenText()))
+	}
+	p.next()
+}
+
+func (p *queryParser) or() Query {
+	qs := []Query{p.and()}
+	for p.err == nil && p.keyword("or") {
+		qs = append(qs, p.and())
+	}
+	if len(qs) == 1 {
+		return qs[0]
+	}
+	return Or(qs...)
+}
+
+func (p *queryParser) and() Query {
+	qs := []Query{p.unary()}
+	for p.err == nil && p.keyword("and") {
+		qs = append(qs, p.unary())
+	}
+	if len(qs) == 1 {
+		return qs[0]
+	}
+	return And(qs...)
+}
+
+func (p *queryParser) unary() Query {
+	switch {
+	case p.keyword("not"):
+		return Not(p.unary())
+	case p.keyword("browser"):
+		p.expect('(')
+		q := p.or()
+		p.expect(')')
+		return AnyBrowser(q)
+	case p.tok == '(':
+		p.next()
+		q := p.or()
+		p.expect(')')
+		return q
+	}
+	return p.predicate()
+}
+
+func (p *queryParser) predicate() Query {
+	if p.tok != scanner.Ident {
+		p.fail("expected field, got " + p.s.TokenText())
+		return And()
+	}
+	field := p.s.TokenText()
+	p.next()
+
+	op := p.s.TokenText()
+	if p.tok == '=' || p.tok == '~' || p.tok == scanner.Ident {
+		op = strings.ToLower(op)
+	}
+	op, ok := queryOps[op]
+	if !ok {
+		p.fail("expected operator, got " + p.s.TokenText())
+		return And()
+	}
+	p.next()
+
+	var args []string
+	if op == "in" {
+		p.expect('(')
+		for p.err == nil && p.tok != ')' {
+			if len(args) > 0 {
+				p.expect(',')
+			}
+			args = append(args, p.value())
+		}
+		p.expect(')')
+	} else {
+		args = append(args, p.value())
+	}
+	if p.err != nil {
+		return And()
+	}
+
+	q, err := Where(field, op, args...)
+	if err != nil {
+		p.fail(err.Error())
+		return And()
+	}
+	return q
+}
+
+func (p *queryParser) value() string {
+	if p.tok != scanner.String && p.tok != scanner.RawString {
+		p.fail("expected quoted value, got " + p.s.TokenText())
+		return ""
+	}
+	v, err := strconv.Unquote(p.s.TokenText())
+	if err != nil {
+		p.fail(err.Error())
+	}
+	p.next()
+	return v
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	user := &User{
+		Browsers: []string{"Mozilla/5.0 (Android; Linux armv7l)", "Opera/9.80"},
+		Company:  "Flashpoint",
+		Country:  "Peru",
+		Email:    "a@b.edu",
+		Job:      "Programmer",
+		Name:     "Sharon Crawford",
+	}
+	cases := []struct {
+		query string
+		match bool
+	}{
+		{`browsers contains "Android"`, true},
+		{`browsers contains "MSIE"`, false},
+		{`browsers = "Opera/9.80"`, true},
+		{`name equals "Sharon"`, false},
+		{`name ~ "^Sh.*d$"`, true},
+		{"email matches `\\.edu$`", true},
+		{`country in ("Chile", "Peru")`, true},
+		{`country in ()`, false},
+		{`not company contains "flash"`, true},
+		{`job = "Manager" or browsers contains "Opera" and country = "Peru"`, true},
+		{`(job = "Manager" or browsers contains "Opera") and country = "Chile"`, false},
+		{`NOT (name contains "x" OR phone = "")`, false},
+		// оба условия по отдельности выполняются, но на разных браузерах
+		{`browsers contains "Android" and browsers contains "Opera"`, true},
+		{`browser(browsers contains "Android" and browsers contains "Opera")`, false},
+		{`browser(browsers contains "Android" and browsers contains "armv7l") and country = "Peru"`, true},
+		{`BROWSER(browsers contains "Opera" or name = "x")`, true},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.query)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if q.Match(user) != c.match {
+			t.Errorf("%s\nGot: %v\nExpected: %v", c.query, !c.match, c.match)
+		}
+		// String дает запрос, который разбирается в тот же самый
+		again, err := ParseQuery(q.String())
+		if err != nil || again.String() != q.String() {
+			t.Errorf("%s printed as %s, parsed back as %v (%v)", c.query, q, again, err)
+		}
+	}
+
+	for _, bad := range []string{
+		``,
+		`salary = "1"`,
+		`name like "x"`,
+		`name = x`,
+		`name ~ "("`,
+		`name = "x" and`,
+		`(name = "x"`,
+		`name in ("x" "y")`,
+		`name = "x" name = "y"`,
+		`browser name = "x"`,
+		`browser(name = "x"`,
+	} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestScanUsers(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// тот же отчет, что и FastSearch, но через запрос
+	var found []string
+	err = ScanUsers(file, androidAndMSIE, func(i int, u *User) {
+		found = append(found, u.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	SlowSearch(out)
+	if expected := strings.Count(out.String(), " <"); len(found) != expected {
+		t.Errorf("wrong number of users\nGot: %v\nExpected: %v", len(found), expected)
+	}
+
+	err = ScanUsers(strings.NewReader("{\"name\":\"a\"}\n{\"browsers\":[\"x\"]}\nnot json\n"), nil, func(i int, u *User) {
+		if i == 1 && u.Name != "" {
+			t.Errorf("user fields kept from previous line: %+v", u)
+		}
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected error on line 3, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Redaction says how values of a field are written in reports.
+type Redaction struct {
+	// Policy is one of
+	//	clear    as it is
+	//	at       @ written as " [at] ", the FastSearch email format
+	//	mask     every character but @ and spaces as *
+	//	partial  Reveal characters at both ends shown, the rest masked, both parts of an email on their own
+	//	hash     first 16 hex digits of HMAC-SHA256 keyed with Salt, equal values stay equal, Salt is required
+	//	drop     left out
+	Policy string
+	Reveal int
+	Salt   string
+}
+
+// RedactionPolicy maps fields to their redactions, fields not in it are written as they are.
+type RedactionPolicy map[string]Redaction
+
+// Redactions apply to the search report and aggregation reports.
+var Redactions = RedactionPolicy{"email": {Policy: "at"}}
+
+// Apply returns the redacted v, ok is false if it is dropped.
+func (r Redaction) Apply(v string) (res string, ok bool) {
+	switch r.Policy {
+	case "at":
+		return strings.ReplaceAll(v, "@", " [at] "), true
+	case "mask":
+		return maskRunes(v, 0), true
+	case "partial":
+		parts := strings.Split(v, "@")
+		for i, p := range parts {
+			parts[i] = maskRunes(p, r.Reveal)
+		}
+		return strings.Join(parts, "@"), true
+	case "hash":
+		mac := hmac.New(sha256.New, []byte(r.Salt))
+		mac.Write([]byte(v))
+		return hex.EncodeToString(mac.Sum(nil))[:16], true
+	case "drop":
+		return "", false
+	}
+	return v, true
+}
+
+// maskRunes masks v but reveal runes at both ends, all of it if it is too short to hide anything
+func maskRunes(v string, reveal int) string {
+	runes := []rune(v)
+	if len(runes) <= 2*reveal {
+		reveal = 0
+	}
+	for i, r := range runes {
+		if i >= reveal && i < len(runes)-reveal && r != '@' && r != ' ' {
+			runes[i] = '*'
+		}
+	}
+	return string(runes)
+}
+
+// apply redacts v, a value of field
+func (p RedactionPolicy) apply(field, v string) (string, bool) {
+	r, ok := p[field]
+	if !ok {
+		return v, true
+	}
+	return r.Apply(v)
+}
+
+// ParseRedactions parses comma separated field=policy pairs, like
+//
+//	email=partial:2,name=mask,phone=hash:salt,company=drop
+//
+// partial takes the number of characters to reveal, 1 by default, hash requires the salt.
+func ParseRedactions(spec string) (RedactionPolicy, error) {
+	p := RedactionPolicy{}
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		field, value, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		if !ok {
+			return nil, fmt.Errorf("redaction: expected field=policy, got %q", pair)
+		}
+		if _, ok := userFields[field]; !ok {
+			return nil, fmt.Errorf("redaction: unknown field %q", field)
+		}
+		policy, arg, hasArg := strings.Cut(strings.TrimSpace(value), ":")
+		r := Redaction{Policy: policy}
+		switch policy {
+		case "clear", "at", "mask", "drop":
+			if hasArg {
+				return nil, fmt.Errorf("redaction: %s: %s takes no argument", field, policy)
+			}
+		case "partial":
+			r.Reveal = 1
+			if hasArg {
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("redaction: %s: expected number of characters to reveal, got %q", field, arg)
+				}
+				r.Reveal = n
+			}
+		case "hash":
+			if arg == "" {
+				return nil, fmt.Errorf("redaction: %s: hash requires a salt, like hash:salt", field)
+			}
+			r.Salt = arg
+		default:
+			return nil, fmt.Errorf("redaction: %s: unknown policy %q", field, policy)
+		}
+		p[field] = r
+	}
+	return p, nil
+}
+
+// With returns p with the redactions of other replacing its own.
+func (p RedactionPolicy) With(other RedactionPolicy) RedactionPolicy {
+	res := RedactionPolicy{}
+	for field, r := range p {
+		res[field] = r
+	}
+	for field, r := range other {
+		res[field] = r
+	}
+	return res
+}
+
+func (p RedactionPolicy) String() string {
+	pairs := make([]string, 0, len(p))
+	for field, r := range p {
+		pair := field + "=" + r.Policy
+		switch r.Policy {
+		case "partial":
+			pair += ":" + strconv.Itoa(r.Reveal)
+		case "hash":
+			pair += ":" + r.Salt
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// checkGroupBy makes sure redacted group keys stay apart: mask, partial and drop
+// can give different values the same key, merging groups with no way to add them up.
+func (p RedactionPolicy) checkGroupBy(fields []string) error {
+	for _, field := range fields {
+		switch r := p[field]; r.Policy {
+		case "mask", "partial", "drop":
+			return fmt.Errorf("redaction: %s=%s would merge groups by %s, hash it instead", field, r.Policy, field)
+		}
+	}
+	return nil
+}
+
+// redacted returns a copy of the report with Redactions applied to keys and top values.
+// Dropped top values are left empty.
+func (rep *Report) redacted() (*Report, error) {
+	if err := Redactions.checkGroupBy(rep.GroupBy); err != nil {
+		return nil, err
+	}
+	res := *rep
+	res.Groups = make([]Group, len(rep.Groups))
+	for i, g := range rep.Groups {
+		g.Key = append([]string(nil), g.Key...)
+		for j, v := range g.Key {
+			g.Key[j], _ = Redactions.apply(rep.GroupBy[j], v)
+		}
+		if g.Top != nil {
+			g.Top = append([]TopValue(nil), g.Top...)
+			for j := range g.Top {
+				g.Top[j].Value, _ = Redactions.apply(rep.Top, g.Top[j].Value)
+			}
+		}
+		res.Groups[i] = g
+	}
+	return &res, nil
+}
+
+// foundUserLine is a found user in the SlowSearch report
+var foundUserLine = regexp.MustCompile(`^\[(\d+)\] (.*) <([^<>]*)>$`)
+
+// redactSearchReport copies the search report of SlowSearch to out with Redactions
+// applied to the found users.
+func redactSearchReport(out io.Writer, report []byte) error {
+	b := strings.Builder{}
+	for _, line := range strings.SplitAfter(string(report), "\n") {
+		m := foundUserLine.FindStringSubmatch(strings.TrimSuffix(line, "\n"))
+		if m == nil {
+			b.WriteString(line)
+			continue
+		}
+		i, _ := strconv.Atoi(m[1])
+		foundUser{i: i, name: m[2], email: strings.ReplaceAll(m[3], " [at] ", "@")}.write(&b)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
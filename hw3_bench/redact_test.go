@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// withRedactions подменяет политику на время теста
+func withRedactions(t *testing.T, spec string) {
+	t.Helper()
+	p, err := ParseRedactions(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := Redactions
+	Redactions = orig.With(p)
+	t.Cleanup(func() { Redactions = orig })
+}
+
+func TestRedactionApply(t *testing.T) {
+	cases := []struct {
+		r        Redaction
+		in       string
+		expected string
+		ok       bool
+	}{
+		{Redaction{}, "Jonathan@Muxo.edu", "Jonathan@Muxo.edu", true},
+		{Redaction{Policy: "clear"}, "Jonathan@Muxo.edu", "Jonathan@Muxo.edu", true},
+		{Redaction{Policy: "at"}, "Jonathan@Muxo.edu", "Jonathan [at] Muxo.edu", true},
+		{Redaction{Policy: "mask"}, "Jonathan@Muxo.edu", "********@********", true},
+		{Redaction{Policy: "mask"}, "John Doe", "**** ***", true},
+		{Redaction{Policy: "partial", Reveal: 2}, "Jonathan@Muxo.edu", "Jo****an@Mu****du", true},
+		{Redaction{Policy: "partial", Reveal: 1}, "Иван Петров", "И*** *****в", true},
+		// слишком короткое значение маскируется целиком
+		{Redaction{Policy: "partial", Reveal: 2}, "ab@c", "**@*", true},
+		{Redaction{Policy: "drop"}, "Jonathan@Muxo.edu", "", false},
+	}
+	for _, c := range cases {
+		got, ok := c.r.Apply(c.in)
+		if got != c.expected || ok != c.ok {
+			t.Errorf("%+v on %q\nGot: %q %v\nExpected: %q %v", c.r, c.in, got, ok, c.expected, c.ok)
+		}
+	}
+
+	// одинаковые значения с одной солью дают одинаковый хеш, с разной - разный
+	a, _ := Redaction{Policy: "hash", Salt: "s1"}.Apply("Jonathan@Muxo.edu")
+	b, _ := Redaction{Policy: "hash", Salt: "s1"}.Apply("Jonathan@Muxo.edu")
+	c, _ := Redaction{Policy: "hash", Salt: "s2"}.Apply("Jonathan@Muxo.edu")
+	if a != b || a == c || len(a) != 16 || strings.Contains(a, "Jonathan") {
+		t.Errorf("bad hashes %q %q %q", a, b, c)
+	}
+}
+
+func TestParseRedactions(t *testing.T) {
+	p, err := ParseRedactions(" email=partial:2, name=mask,phone=hash:pepper,company=drop,job=partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "company=drop,email=partial:2,job=partial:1,name=mask,phone=hash:pepper"
+	if p.String() != expected {
+		t.Errorf("wrong policy\nGot: %v\nExpected: %v", p, expected)
+	}
+	if p, err := ParseRedactions(""); err != nil || len(p) != 0 {
+		t.Errorf("empty spec: %v %v", p, err)
+	}
+
+	for _, spec := range []string{
+		"email",
+		"password=mask",
+		"email=scramble",
+		"email=mask:2",
+		"email=partial:x",
+		"email=partial:-1",
+		"email=hash",
+		"email=hash:",
+	} {
+		if _, err := ParseRedactions(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestRedactedSearch(t *testing.T) {
+	// политика по умолчанию не меняет вывод
+	slowOut, fastOut := new(bytes.Buffer), new(bytes.Buffer)
+	SlowSearch(slowOut)
+	FastSearch(fastOut)
+	if slowOut.String() != fastOut.String() {
+		t.Errorf("default policy changes the output")
+	}
+
+	withRedactions(t, "email=partial:1,name=drop")
+	for _, search := range []func(*bytes.Buffer){
+		func(out *bytes.Buffer) { FastSearch(out) },
+		func(out *bytes.Buffer) { FastSearchParallel(out, 3) },
+		func(out *bytes.Buffer) { FastSearchRaw(out) },
+	} {
+		out := new(bytes.Buffer)
+		search(out)
+		lines := strings.Split(out.String(), "\n")
+		if lines[1] != "[1] <e*****************o@T************o>" {
+			t.Errorf("wrong redacted user\nGot: %v\nExpected: %v", lines[1], "[1] <e*****************o@T************o>")
+		}
+		if strings.Contains(out.String(), "[at]") {
+			t.Errorf("email not redacted:\n%v", out.String())
+		}
+	}
+}
+
+func TestRedactedReport(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := run([]string{"-redact", "company=hash:s,email=mask", "-group", "company", "-top", "email", "-n", "1", "-format", "csv", "-"},
+		strings.NewReader(aggregateUsers), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "acme") || strings.Contains(out.String(), "Acme") {
+		t.Errorf("values not redacted:\n%v", out.String())
+	}
+	if Redactions.String() != "email=at" {
+		t.Errorf("run left policy %v", Redactions)
+	}
+
+	// отчет не меняется при записи
+	withRedactions(t, "company=hash:s")
+	rep, err := (&Aggregation{GroupBy: []string{"company"}}).Run(strings.NewReader(aggregateUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := rep.Groups[0].Key[0]
+	out.Reset()
+	if err := rep.Write(out, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if key == "" || rep.Groups[0].Key[0] != key || strings.Contains(out.String(), key) {
+		t.Errorf("wrong redaction of %q:\n%v", key, out.String())
+	}
+
+	// Acme и Initech после маскирования или удаления стали бы одной группой
+	for _, spec := range []string{"company=drop", "company=mask", "company=partial:1"} {
+		withRedactions(t, spec)
+		if err := rep.Write(out, "csv"); err == nil {
+			t.Errorf("expected error writing groups with %s", spec)
+		}
+		if err := run([]string{"-redact", spec, "-group", "country,company", "-"}, strings.NewReader(aggregateUsers), out); err == nil {
+			t.Errorf("expected CLI error grouping with %s", spec)
+		}
+	}
+	// по полям вне ключа группы маскировать можно
+	out.Reset()
+	if err := run([]string{"-redact", "company=mask", "-group", "country", "-top", "company", "-format", "csv", "-"}, strings.NewReader(aggregateUsers), out); err != nil || strings.Contains(out.String(), "Acme") {
+		t.Errorf("wrong masked top (%v):\n%v", err, out.String())
+	}
+
+	if err := run([]string{"-redact", "email=scramble"}, nil, out); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
+
+func TestRedactedSlowCLI(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected string
+	}{
+		{"email=drop,name=mask", "found users:\n[1] ***** *****\n[5] ******* *****\n[15] ****** ******\n"},
+		{"email=partial:1", "found users:\n[1] Susan Ellis <e*****************o@T************o>\n[5] Melissa Price <y***g@L*******t>\n"},
+	}
+	for _, c := range cases {
+		for _, args := range [][]string{{"-redact", c.spec}, {"-slow", "-redact", c.spec}} {
+			out := new(bytes.Buffer)
+			if err := run(args, nil, out); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(out.String(), c.expected) || !strings.HasSuffix(out.String(), "\nTotal unique browsers 114\n") {
+				t.Errorf("wrong report for %v\nGot:\n%v\nExpected to start with:\n%v", args, out.String(), c.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// RawUser holds the browsers, email and name of a users line as slices of the line itself.
+type RawUser struct {
+	Browsers [][]byte
+	Email    []byte
+	Name     []byte
+}
+
+// maxScanDepth is the nesting limit of encoding/json
+const maxScanDepth = 10000
+
+var (
+	keyBrowsers = []byte("browsers")
+	keyEmail    = []byte("email")
+	keyName     = []byte("name")
+)
+
+// Scan fills u from a JSON users line without allocating, once u.Browsers has grown enough.
+// The fields point into line, escaped strings are unescaped in place, so line is modified.
+// Other fields are checked and skipped. Keys match as in encoding/json, ignoring case.
+// Unlike encoding/json, invalid UTF-8 is kept as it is.
+func (u *RawUser) Scan(line []byte) error {
+	u.Browsers = u.Browsers[:0]
+	u.Email, u.Name = nil, nil
+
+	s := &rawScanner{data: line}
+	s.skipSpace()
+	var err error
+	switch s.peek() {
+	case '{':
+		err = s.user(u)
+	case 'n':
+		err = s.literal("null")
+	default:
+		err = s.errorf("expected object")
+	}
+	if err != nil {
+		return err
+	}
+	s.skipSpace()
+	if s.pos < len(s.data) {
+		return s.errorf("unexpected data after object")
+	}
+	return nil
+}
+
+type rawScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *rawScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", s.pos, fmt.Sprintf(format, args...))
+}
+
+// peek returns the current byte, 0 at the end
+func (s *rawScanner) peek() byte {
+	if s.pos < len(s.data) {
+		return s.data[s.pos]
+	}
+	return 0
+}
+
+func (s *rawScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *rawScanner) literal(word string) error {
+	if len(s.data)-s.pos < len(word) || string(s.data[s.pos:s.pos+len(word)]) != word {
+		return s.errorf("expected %s", word)
+	}
+	s.pos += len(word)
+	return nil
+}
+
+// members calls value for every key of the object at the current position,
+// value must consume the value of the key
+func (s *rawScanner) members(value func(key []byte) error) error {
+	s.pos++ // {
+	s.skipSpace()
+	if s.peek() == '}' {
+		s.pos++
+		return nil
+	}
+	for {
+		s.skipSpace()
+		if s.peek() != '"' {
+			return s.errorf("expected key")
+		}
+		key, err := s.str()
+		if err != nil {
+			return err
+		}
+		s.skipSpace()
+		if s.peek() != ':' {
+			return s.errorf("expected :")
+		}
+		s.pos++
+		s.skipSpace()
+		if err := value(key); err != nil {
+			return err
+		}
+		s.skipSpace()
+		switch s.peek() {
+		case ',':
+			s.pos++
+		case '}':
+			s.pos++
+			return nil
+		default:
+			return s.errorf("expected , or }")
+		}
+	}
+}
+
+// elements calls value for every element of the array at the current position
+func (s *rawScanner) elements(value func() error) error {
+	s.pos++ // [
+	s.skipSpace()
+	if s.peek() == ']' {
+		s.pos++
+		return nil
+	}
+	for {
+		s.skipSpace()
+		if err := value(); err != nil {
+			return err
+		}
+		s.skipSpace()
+		switch s.peek() {
+		case ',':
+			s.pos++
+		case ']':
+			s.pos++
+			return nil
+		default:
+			return s.errorf("expected , or ]")
+		}
+	}
+}
+
+func (s *rawScanner) user(u *RawUser) error {
+	return s.members(func(key []byte) error {
+		switch {
+		case bytes.EqualFold(key, keyBrowsers):
+			return s.browsers(u)
+		case bytes.EqualFold(key, keyEmail):
+			return s.strField(&u.Email)
+		case bytes.EqualFold(key, keyName):
+			return s.strField(&u.Name)
+		}
+		return s.skipValue(2)
+	})
+}
+
+// strField sets dst to a string value, null leaves it as it is like in encoding/json
+func (s *rawScanner) strField(dst *[]byte) error {
+	switch s.peek() {
+	case 'n':
+		return s.literal("null")
+	case '"':
+		v, err := s.str()
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+	return s.errorf("expected string")
+}
+
+func (s *rawScanner) browsers(u *RawUser) error {
+	u.Browsers = u.Browsers[:0]
+	switch s.peek() {
+	case 'n':
+		return s.literal("null")
+	case '[':
+		return s.elements(func() error {
+			var b []byte
+			if err := s.strField(&b); err != nil {
+				return err
+			}
+			u.Browsers = append(u.Browsers, b)
+			return nil
+		})
+	}
+	return s.errorf("expected array")
+}
+
+// str returns the contents of the string at the current position, unescaped in place.
+func (s *rawScanner) str() ([]byte, error) {
+	start := s.pos + 1
+	i := start
+	for i < len(s.data) && s.data[i] != '"' && s.data[i] != '\\' && s.data[i] >= 0x20 {
+		i++
+	}
+	if i < len(s.data) && s.data[i] == '"' {
+		s.pos = i + 1
+		return s.data[start:i], nil
+	}
+
+	// w trails r, unescaped text is never longer
+	data := s.data
+	w, r := i, i
+	for r < len(data) {
+		c := data[r]
+		switch {
+		case c == '"':
+			s.pos = r + 1
+			return data[start:w], nil
+		case c < 0x20:
+			s.pos = r
+			return nil, s.errorf("control character in string")
+		case c != '\\':
+			data[w] = c
+			w++
+			r++
+			continue
+		}
+		if r+1 >= len(data) {
+			break
+		}
+		switch e := data[r+1]; e {
+		case '"', '\\', '/':
+			data[w] = e
+		case 'b':
+			data[w] = '\b'
+		case 'f':
+			data[w] = '\f'
+		case 'n':
+			data[w] = '\n'
+		case 'r':
+			data[w] = '\r'
+		case 't':
+			data[w] = '\t'
+		case 'u':
+			rr := hex4(data[r+2:])
+			if rr < 0 {
+				s.pos = r
+				return nil, s.errorf("bad \\u escape")
+			}
+			r += 6
+			// a surrogate without its pair becomes U+FFFD as in encoding/json
+			if utf16.IsSurrogate(rr) {
+				rr1 := rune(-1)
+				if r+1 < len(data) && data[r] == '\\' && data[r+1] == 'u' {
+					rr1 = hex4(data[r+2:])
+				}
+				if dec := utf16.DecodeRune(rr, rr1); dec != utf8.RuneError {
+					r += 6
+					rr = dec
+				} else {
+					rr = utf8.RuneError
+				}
+			}
+			w += utf8.EncodeRune(data[w:], rr)
+			continue
+		default:
+			s.pos = r
+			return nil, s.errorf("bad escape")
+		}
+		w++
+		r += 2
+	}
+	s.pos = len(data)
+	return nil, s.errorf("unterminated string")
+}
+
+// hex4 decodes the 4 hex digits starting b, -1 if there are no such
+func hex4(b []byte) rune {
+	if len(b) < 4 {
+		return -1
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return -1
+		}
+		r = r*16 + rune(c)
+	}
+	return r
+}
+
+func (s *rawScanner) skipValue(depth int) error {
+	if depth > maxScanDepth {
+		return s.errorf("exceeded max depth")
+	}
+	switch c := s.peek(); {
+	case c == '{':
+		return s.members(func(key []byte) error {
+			return s.skipValue(depth + 1)
+		})
+	case c == '[':
+		return s.elements(func() error {
+			return s.skipValue(depth + 1)
+		})
+	case c == '"':
+		_, err := s.str()
+		return err
+	case c == 't':
+		return s.literal("true")
+	case c == 'f':
+		return s.literal("false")
+	case c == 'n':
+		return s.literal("null")
+	case c == '-' || '0' <= c && c <= '9':
+		return s.number()
+	}
+	return s.errorf("expected value")
+}
+
+func (s *rawScanner) digits() int {
+	n := 0
+	for c := s.peek(); '0' <= c && c <= '9'; c = s.peek() {
+		s.pos++
+		n++
+	}
+	return n
+}
+
+func (s *rawScanner) number() error {
+	if s.peek() == '-' {
+		s.pos++
+	}
+	switch c := s.peek(); {
+	case c == '0':
+		s.pos++
+	case '1' <= c && c <= '9':
+		s.digits()
+	default:
+		return s.errorf("bad number")
+	}
+	if s.peek() == '.' {
+		s.pos++
+		if s.digits() == 0 {
+			return s.errorf("bad number")
+		}
+	}
+	if c := s.peek(); c == 'e' || c == 'E' {
+		s.pos++
+		if c := s.peek(); c == '+' || c == '-' {
+			s.pos++
+		}
+		if s.digits() == 0 {
+			return s.errorf("bad number")
+		}
+	}
+	return nil
+}
+
+var (
+	tokenMSIE    = []byte("MSIE")
+	tokenAndroid = []byte("Android")
+)
+
+func (r *searchReport) addRaw(i int, user *RawUser) {
+	r.lines = i + 1
+	isAndroid, isMSIE := false, false
+	for _, browser := range user.Browsers {
+		android := bytes.Contains(browser, tokenAndroid)
+		msie := bytes.Contains(browser, tokenMSIE)
+		if !android && !msie {
+			continue
+		}
+		isAndroid, isMSIE = isAndroid || android, isMSIE || msie
+		r.seenBrowsers.AddBytes(browser)
+	}
+	if isAndroid && isMSIE {
+		r.found = append(r.found, foundUser{i, string(user.Name), string(user.Email)})
+	}
+}
+
+// FastSearchRaw is FastSearch reading users with RawUser.Scan instead of easyjson.
+func FastSearchRaw(out io.Writer) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	if err := FastSearchRawFrom(out, file); err != nil {
+		panic(err)
+	}
+}
+
+// FastSearchRawFrom is FastSearchRaw over users read from r.
+func FastSearchRawFrom(out io.Writer, r io.Reader) error {
+	report, err := searchReader(r, newRawDecoder())
+	if err != nil {
+		return err
+	}
+	report.write(out)
+	return nil
+}
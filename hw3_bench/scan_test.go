@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+// jsonUser - то, что из строки достает encoding/json
+type jsonUser struct {
+	Browsers []string `json:"browsers"`
+	Email    string   `json:"email"`
+	Name     string   `json:"name"`
+}
+
+func rawStrings(u *RawUser) jsonUser {
+	res := jsonUser{Email: string(u.Email), Name: string(u.Name), Browsers: []string{}}
+	for _, b := range u.Browsers {
+		res.Browsers = append(res.Browsers, string(b))
+	}
+	return res
+}
+
+// checkRawUser сверяет RawUser.Scan с encoding/json на строке line
+func checkRawUser(t *testing.T, line []byte) {
+	expected := jsonUser{}
+	jsonErr := json.Unmarshal(line, &expected)
+	if expected.Browsers == nil {
+		expected.Browsers = []string{}
+	}
+
+	u := &RawUser{}
+	err := u.Scan(append([]byte(nil), line...))
+	if (err != nil) != (jsonErr != nil) {
+		t.Fatalf("%q\nGot error: %v\nExpected error: %v", line, err, jsonErr)
+	}
+	if err != nil {
+		return
+	}
+	if got := rawStrings(u); !reflect.DeepEqual(got, expected) {
+		t.Errorf("%q\nGot: %q\nExpected: %q", line, got, expected)
+	}
+}
+
+var rawUserSeeds = []string{
+	`{"browsers":["a","b"],"email":"x@y.z","name":"N"}`,
+	`{"name":"A&B 😀 \ud800 \"q\" \\ \/ \b\f\n\r\t","email":null,"browsers":null}`,
+	` { "NAME" : "upper" , "Browſers":["fold"], "name":"escaped key" } `,
+	`{"browsers":["a",null],"browsers":["last"],"name":"1","name":null}`,
+	`{"company":{"a":[1,-2.5e+3,0.1,true,false,null,{}],"b":[]},"phone":"1"}`,
+	`null`,
+	``,
+	`[]`,
+	`{"name":5}`,
+	`{"browsers":[1]}`,
+	`{"browsers":"a"}`,
+	`{"name":"a"}x`,
+	`{"name":"a",}`,
+	`{"x":01}`,
+	`{"x":1.}`,
+	`{"x":-}`,
+	`{"x":tru}`,
+	`{"name":"bad \x escape"}`,
+	`{"name":"\u12"}`,
+	"{\"name\":\"tab\tinside\"}",
+	`{"name":"unterminated`,
+	`{"name":"\`,
+}
+
+func TestRawUserScan(t *testing.T) {
+	for _, seed := range rawUserSeeds {
+		checkRawUser(t, []byte(seed))
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		checkRawUser(t, line)
+	}
+}
+
+func TestRawUserScanAllocs(t *testing.T) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := data[:bytes.IndexByte(data, '\n')]
+	buf := make([]byte, len(line))
+	u := &RawUser{}
+	allocs := testing.AllocsPerRun(100, func() {
+		// Scan портит строку, поэтому каждый раз берем копию
+		copy(buf, line)
+		if err := u.Scan(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Scan allocates %v times per line", allocs)
+	}
+}
+
+func TestFastSearchRaw(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+	out := new(bytes.Buffer)
+	FastSearchRaw(out)
+	if out.String() != slowOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), slowOut.String())
+	}
+}
+
+// go test -fuzz FuzzRawUser
+func FuzzRawUser(f *testing.F) {
+	for _, seed := range rawUserSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, line []byte) {
+		// encoding/json заменяет невалидный UTF-8, а Scan оставляет как есть
+		if !utf8.Valid(line) {
+			t.Skip()
+		}
+		checkRawUser(t, line)
+	})
+}
+
+func BenchmarkRawUserScan(b *testing.B) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	u := &RawUser{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if err := u.Scan(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkUserUnmarshalJSON(b *testing.B) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			u := User{}
+			if err := u.UnmarshalJSON(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
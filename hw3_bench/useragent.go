@@ -0,0 +1,154 @@
+package main
+
+import "strings"
+
+// UserAgent is what ParseUserAgent makes of a browsers entry.
+type UserAgent struct {
+	Family  string // IE, Edge, Chrome, Firefox, Safari, Opera, ..., Bot or Other
+	Version string // browser version as written, "" if unknown
+	OS      string // Windows, Windows Phone, Android, iOS, macOS, ChromeOS, Linux, BSD, BlackBerry, Symbian or Other
+	Device  string // desktop, mobile, tablet, bot or other
+}
+
+// uaFamilies are tried in order, the first one whose token is in the string,
+// along with requires if set, wins. The version follows the token, or versionAfter
+// if set and found. Browsers built on others mention them, so they go before:
+// Edge and Opera say Chrome, Chrome says Safari, SeaMonkey says Firefox.
+var uaFamilies = []struct {
+	family       string
+	token        string
+	requires     string
+	versionAfter string
+}{
+	{"Edge", "Edge/", "", ""},
+	{"Edge", "Edg/", "", ""},
+	{"Opera", "OPR/", "", ""},
+	{"Opera", "Opera Mini/", "", ""},
+	{"Opera", "Opera/", "", "Version/"},
+	{"Opera", "Opera ", "", ""},
+	{"SeaMonkey", "SeaMonkey/", "", ""},
+	{"Firefox", "Firefox/", "", ""},
+	{"IE Mobile", "IEMobile/", "", ""},
+	{"IE", "MSIE ", "", ""},
+	// IE11 dropped MSIE and is only known by its engine
+	{"IE", "Trident/", "", "rv:"},
+	{"Konqueror", "Konqueror/", "", ""},
+	{"Chrome", "CriOS/", "", ""},
+	{"Chrome", "Chrome/", "", ""},
+	{"Android Browser", "Version/", "Android", ""},
+	{"Safari", "Version/", "Safari/", ""},
+}
+
+// uaBots are substrings of crawlers, matched ignoring case
+var uaBots = []string{"bot", "crawl", "spider", "slurp"}
+
+var uaSystems = []struct {
+	os     string
+	tokens []string
+}{
+	{"Windows Phone", []string{"Windows Phone"}},
+	{"Windows", []string{"Windows", "WinNT", "Win98", "Win95"}},
+	{"Android", []string{"Android"}},
+	{"iOS", []string{"iPhone", "iPad", "iPod"}},
+	{"macOS", []string{"Mac OS X", "Macintosh"}},
+	{"ChromeOS", []string{"CrOS"}},
+	{"BlackBerry", []string{"BlackBerry"}},
+	{"Symbian", []string{"Symbian", "Series60"}},
+	{"BSD", []string{"FreeBSD", "OpenBSD", "NetBSD", "DragonFly"}},
+	{"Linux", []string{"Linux", "X11", "Ubuntu"}},
+}
+
+var (
+	uaTablets = []string{"iPad", "Tablet", "Kindle", "Silk/"}
+	uaMobiles = []string{"Mobile", "iPhone", "iPod", "MIDP", "Opera Mini", "Nokia", "SonyEricsson", "UP.Browser", "UP.Link"}
+)
+
+// ParseUserAgent classifies a user agent string. It doesn't allocate,
+// Version is a substring of ua.
+func ParseUserAgent(ua string) UserAgent {
+	res := UserAgent{Family: "Other", OS: "Other", Device: "other"}
+
+	if containsFoldAny(ua, uaBots) {
+		res.Family, res.Device = "Bot", "bot"
+	} else {
+		for _, f := range uaFamilies {
+			i := strings.Index(ua, f.token)
+			if i < 0 || f.requires != "" && !strings.Contains(ua, f.requires) {
+				continue
+			}
+			res.Family = f.family
+			res.Version = versionAt(ua, i+len(f.token))
+			if f.versionAfter != "" {
+				if j := strings.Index(ua, f.versionAfter); j >= 0 {
+					res.Version = versionAt(ua, j+len(f.versionAfter))
+				}
+			}
+			break
+		}
+	}
+
+	for _, s := range uaSystems {
+		if containsAny(ua, s.tokens) {
+			res.OS = s.os
+			break
+		}
+	}
+
+	if res.Device == "bot" {
+		return res
+	}
+	switch {
+	case containsAny(ua, uaTablets):
+		res.Device = "tablet"
+	case res.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		// Android phones say Mobile, tablets don't
+		res.Device = "tablet"
+	case containsAny(ua, uaMobiles), res.OS == "Windows Phone", res.OS == "BlackBerry", res.OS == "Symbian", res.OS == "iOS":
+		res.Device = "mobile"
+	case res.OS == "Windows", res.OS == "macOS", res.OS == "Linux", res.OS == "BSD", res.OS == "ChromeOS":
+		res.Device = "desktop"
+	}
+	return res
+}
+
+// versionAt returns the dotted version starting at ua[i], like 10.0.1 or 9a3pre
+func versionAt(ua string, i int) string {
+	j := i
+	for j < len(ua) && (ua[j] == '.' || ua[j] == '_' || isAlnum(ua[j])) {
+		j++
+	}
+	return strings.Trim(ua[i:j], "._")
+}
+
+func isAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFoldAny is containsAny ignoring ASCII case, subs must be lower case
+func containsFoldAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		for i := 0; i+len(sub) <= len(s); i++ {
+			if strings.EqualFold(s[i:i+len(sub)], sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uaFields are the UserAgent parts reports can filter and group on
+var uaFields = map[string]func(ua UserAgent) string{
+	"family":  func(ua UserAgent) string { return ua.Family },
+	"version": func(ua UserAgent) string { return ua.Version },
+	"os":      func(ua UserAgent) string { return ua.OS },
+	"device":  func(ua UserAgent) string { return ua.Device },
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected UserAgent
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko",
+			UserAgent{"IE", "11.0", "Windows", "desktop"}},
+		{"Mozilla/4.0 (compatible; GoogleToolbar 4.0.1019.5266-big; Windows XP 5.1; MSIE 6.0.2900.2180)",
+			UserAgent{"IE", "6.0.2900.2180", "Windows", "desktop"}},
+		{"Mozilla/5.0 (compatible; MSIE 10.0; Windows Phone 8.0; Trident/6.0; IEMobile/10.0; ARM; Touch)",
+			UserAgent{"IE Mobile", "10.0", "Windows Phone", "mobile"}},
+		// Android здесь - ОС, а браузер Firefox
+		{"Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1",
+			UserAgent{"Firefox", "10.0.1", "Android", "tablet"}},
+		{"Mozilla/5.0 (Linux; Android 6.0.1; SM-G900H Build/MMB29K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.98 Mobile Safari/537.36",
+			UserAgent{"Chrome", "52.0.2743.98", "Android", "mobile"}},
+		{"Mozilla/5.0 (Linux; U; Android 1.6; en-us; HTC_TATTOO_A3288 Build/DRC79) AppleWebKit/528.5  (KHTML, like Gecko) Version/3.1.2 Mobile Safari/525.20.1",
+			UserAgent{"Android Browser", "3.1.2", "Android", "mobile"}},
+		{"AndroidDownloadManager/5.1 (Linux; U; Android 5.1; Z820 Build/LMY47D)",
+			UserAgent{"Other", "", "Android", "tablet"}},
+		{"Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/33.0.1750.154 Safari/537.36 OPR/20.0.1387.91",
+			UserAgent{"Opera", "20.0.1387.91", "Windows", "desktop"}},
+		{"Opera/9.80 (X11; FreeBSD 8.1-RELEASE i386; Edition Next) Presto/2.12.388 Version/12.10",
+			UserAgent{"Opera", "12.10", "BSD", "desktop"}},
+		{"Mozilla/5.0 (iPad; U; CPU OS 4_2_1 like Mac OS X; ja-jp) AppleWebKit/533.17.9 (KHTML, like Gecko) Version/5.0.2 Mobile/8C148 Safari/6533.18.5",
+			UserAgent{"Safari", "5.0.2", "iOS", "tablet"}},
+		{"Mozilla/5.0 (X11; Linux i686; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 SeaMonkey/2.7.1",
+			UserAgent{"SeaMonkey", "2.7.1", "Linux", "desktop"}},
+		{"Nokia3230/2.0 (5.0614.0) SymbianOS/7.0s Series60/2.1 Profile/MIDP-2.0 Configuration/CLDC-1.0",
+			UserAgent{"Other", "", "Symbian", "mobile"}},
+		{"msnbot/1.1 ( http://search.msn.com/msnbot.htm)",
+			UserAgent{"Bot", "", "Other", "bot"}},
+		{"EmailWolf 1.00",
+			UserAgent{"Other", "", "Other", "other"}},
+	}
+	for _, c := range cases {
+		if ua := ParseUserAgent(c.ua); ua != c.expected {
+			t.Errorf("%s\nGot: %+v\nExpected: %+v", c.ua, ua, c.expected)
+		}
+	}
+
+	ua := "Mozilla/5.0 (Windows NT 6.2; WOW64) AppleWebKit/537.36 (KHTML like Gecko) Chrome/28.0.1469.0 Safari/537.36"
+	if allocs := testing.AllocsPerRun(100, func() { ParseUserAgent(ua) }); allocs != 0 {
+		t.Errorf("ParseUserAgent allocates %v times", allocs)
+	}
+}
+
+func TestUserAgentQuery(t *testing.T) {
+	user := &User{Browsers: []string{
+		"Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1",
+		"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko",
+	}}
+	cases := []struct {
+		query string
+		match bool
+	}{
+		// по подстрокам это пользователь Android и MSIE, а по разбору - нет
+		{`browsers contains "Android"`, true},
+		{`browsers contains "MSIE"`, false},
+		{`family = "IE"`, true},
+		{`family = "Android Browser"`, false},
+		{`os = "Android" and device = "desktop"`, true},
+		{"version ~ `^11\\.`", true},
+		{`family in ("Chrome", "Safari")`, false},
+	}
+	for _, c := range cases {
+		if q := MustParseQuery(c.query); q.Match(user) != c.match {
+			t.Errorf("%s\nGot: %v\nExpected: %v", c.query, !c.match, c.match)
+		}
+	}
+}
+
+func BenchmarkParseUserAgent(b *testing.B) {
+	ua := "Mozilla/5.0 (Linux; Android 6.0.1; SM-G900H Build/MMB29K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.98 Mobile Safari/537.36"
+	for i := 0; i < b.N; i++ {
+		ParseUserAgent(ua)
+	}
+}